@@ -0,0 +1,389 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// strippedFields are never recorded as owned in managedFields, matching the
+// apiserver.
+var strippedFields = fieldpath.NewSet(
+	fieldpath.MakePathOrDie("apiVersion"),
+	fieldpath.MakePathOrDie("kind"),
+	fieldpath.MakePathOrDie("metadata", "name"),
+	fieldpath.MakePathOrDie("metadata", "namespace"),
+	fieldpath.MakePathOrDie("metadata", "creationTimestamp"),
+	fieldpath.MakePathOrDie("metadata", "selfLink"),
+	fieldpath.MakePathOrDie("metadata", "uid"),
+	fieldpath.MakePathOrDie("metadata", "generation"),
+	fieldpath.MakePathOrDie("metadata", "managedFields"),
+	fieldpath.MakePathOrDie("metadata", "resourceVersion"),
+)
+
+// Conflict is a field that an apply would change while another manager owns
+// it, or that a three-way merge changes where the current object diverged.
+// Manager is empty when no manager is known to own the field.
+type Conflict struct {
+	Manager string
+	Path    fieldpath.Path
+}
+
+func (c Conflict) String() string {
+	if c.Manager == "" {
+		return FormatPath(c.Path)
+	}
+	return fmt.Sprintf("%v owned by %q", FormatPath(c.Path), c.Manager)
+}
+
+// ConflictError is returned by Apply when the applied config changes fields
+// owned by other managers and force is not set.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	conflicts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		conflicts[i] = c.String()
+	}
+	return fmt.Sprintf("apply failed with %d conflict(s): %v", len(e.Conflicts), strings.Join(conflicts, "; "))
+}
+
+// applyOutcome is the result of simulating a server-side apply.
+type applyOutcome struct {
+	object        *unstructured.Unstructured
+	managedFields []metav1.ManagedFieldsEntry
+	conflicts     []Conflict
+	configSet     *fieldpath.Set
+	removed       *fieldpath.Set
+}
+
+// Apply simulates a server-side apply of config onto live by manager and
+// returns the resulting object with its managedFields updated.
+//
+// A conflict is a field set by config to a value different from live while
+// another manager owns it. With force false, conflicts are returned as a
+// *ConflictError. With force true, manager takes the conflicting fields over
+// and they are removed from the other managers' entries; entries left empty
+// are dropped. Fields the manager applied previously but omits from config
+// are removed unless another manager still owns them.
+func (r *Creator) Apply(ctx context.Context, live, config *unstructured.Unstructured, manager string, force bool) (*unstructured.Unstructured, error) {
+	outcome, err := r.apply(ctx, live, config, manager, force)
+	if err != nil {
+		return nil, err
+	}
+	if len(outcome.conflicts) > 0 && !force {
+		return nil, &ConflictError{Conflicts: outcome.conflicts}
+	}
+	return outcome.object, nil
+}
+
+func (r *Creator) apply(ctx context.Context, live, config *unstructured.Unstructured, manager string, force bool) (*applyOutcome, error) {
+	if live == nil || config == nil {
+		return nil, fmt.Errorf("live and config objects cannot be nil")
+	}
+	liveGVK, err := ObjectGVK(live)
+	if err != nil {
+		return nil, fmt.Errorf("live: %v", err)
+	}
+	configGVK, err := ObjectGVK(config)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	if liveGVK != configGVK {
+		return nil, fmt.Errorf("cannot apply %v onto %v", configGVK, liveGVK)
+	}
+	liveTV, err := r.typedObject(ctx, live)
+	if err != nil {
+		return nil, err
+	}
+	config = withoutManagedFields(config)
+	configTV, err := r.typedObject(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	configSet, err := configTV.ToFieldSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute config field set: %v", err)
+	}
+	configSet = configSet.Difference(strippedFields)
+	comparison, err := liveTV.Compare(configTV)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare live and config: %v", err)
+	}
+	changed := comparison.Modified.Union(comparison.Added)
+
+	entries := live.GetManagedFields()
+	sets := make([]*fieldpath.Set, len(entries))
+	applyIndex := -1
+	otherOwned := fieldpath.NewSet()
+	outcome := &applyOutcome{configSet: configSet}
+	for i, entry := range entries {
+		if sets[i], err = SetFromManagedField(entry); err != nil {
+			return nil, err
+		}
+		if isApplyEntryFor(entry, manager) {
+			applyIndex = i
+			continue
+		}
+		otherOwned = otherOwned.Union(sets[i])
+		sets[i].Leaves().Intersection(changed).Iterate(func(p fieldpath.Path) {
+			outcome.conflicts = append(outcome.conflicts, Conflict{Manager: entry.Manager, Path: p.Copy()})
+		})
+	}
+
+	merged, err := liveTV.Merge(configTV)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config into live: %v", err)
+	}
+	outcome.removed = fieldpath.NewSet()
+	if applyIndex >= 0 {
+		outcome.removed = sets[applyIndex].Leaves().Difference(configSet).Difference(otherOwned)
+		if merged, err = subtractTyped(merged, outcome.removed); err != nil {
+			return nil, err
+		}
+	}
+	result, err := ToUnstructured(merged)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(result.Object)
+
+	fieldsV1, err := configSet.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	now := metav1.Now()
+	applied := metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: config.GetAPIVersion(),
+		Time:       &now,
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: fieldsV1},
+	}
+	for i, entry := range entries {
+		if i == applyIndex {
+			outcome.managedFields = append(outcome.managedFields, applied)
+			continue
+		}
+		if force {
+			if entry, err = withoutConflicts(entry, sets[i], outcome.conflicts); err != nil {
+				return nil, err
+			}
+			if entry.FieldsV1 == nil {
+				continue
+			}
+		}
+		outcome.managedFields = append(outcome.managedFields, entry)
+	}
+	if applyIndex < 0 {
+		outcome.managedFields = append(outcome.managedFields, applied)
+	}
+	result.SetManagedFields(outcome.managedFields)
+	outcome.object = result
+	return outcome, nil
+}
+
+// isApplyEntryFor reports whether entry records manager's applies to the main
+// resource.
+func isApplyEntryFor(entry metav1.ManagedFieldsEntry, manager string) bool {
+	return entry.Manager == manager && entry.Operation == metav1.ManagedFieldsOperationApply && entry.Subresource == ""
+}
+
+// withoutConflicts removes the fields entry loses to conflicts from its
+// fieldset. The returned entry has a nil FieldsV1 when it no longer owns
+// anything.
+func withoutConflicts(entry metav1.ManagedFieldsEntry, set *fieldpath.Set, conflicts []Conflict) (metav1.ManagedFieldsEntry, error) {
+	lost := fieldpath.NewSet()
+	for _, c := range conflicts {
+		if c.Manager == entry.Manager {
+			lost.Insert(c.Path)
+		}
+	}
+	if lost.Empty() {
+		return entry, nil
+	}
+	remaining := set.Difference(lost)
+	if remaining.Leaves().Empty() {
+		entry.FieldsV1 = nil
+		return entry, nil
+	}
+	raw, err := remaining.ToJSON()
+	if err != nil {
+		return entry, err
+	}
+	entry.FieldsV1 = &metav1.FieldsV1{Raw: raw}
+	return entry, nil
+}
+
+// ApplyResult summarizes the changes an apply would make.
+type ApplyResult struct {
+	// Added, Changed and Removed count the leaf fields the apply would add,
+	// modify and remove.
+	Added   int
+	Changed int
+	Removed int
+	// Conflicts lists the fields the apply would need to force.
+	Conflicts []Conflict
+}
+
+// ApplyDryRun simulates applying config onto live by manager, like Apply,
+// and tallies the resulting changes without returning the object. Conflicts
+// are reported rather than returned as an error; the counts describe the
+// outcome of a forced apply.
+func (r *Creator) ApplyDryRun(ctx context.Context, live, config *unstructured.Unstructured, manager string) (ApplyResult, error) {
+	outcome, err := r.apply(ctx, live, config, manager, true)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	before, err := r.typedObject(ctx, withoutManagedFields(live))
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	after, err := r.typedObject(ctx, withoutManagedFields(outcome.object))
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	comparison, err := before.Compare(after)
+	if err != nil {
+		return ApplyResult{}, fmt.Errorf("failed to compare objects: %v", err)
+	}
+	return ApplyResult{
+		Added:     comparison.Added.Leaves().Size(),
+		Changed:   comparison.Modified.Leaves().Size(),
+		Removed:   comparison.Removed.Leaves().Size(),
+		Conflicts: outcome.conflicts,
+	}, nil
+}
+
+// FieldsToRemove returns the leaf fields a server-side apply of config by
+// manager would remove from live: those manager applied previously and
+// config omits, unless another manager still owns them. Fields manager owns
+// through Update operations are never removed by an apply.
+func (r *Creator) FieldsToRemove(ctx context.Context, live, config *unstructured.Unstructured, manager string) (*fieldpath.Set, error) {
+	outcome, err := r.apply(ctx, live, config, manager, true)
+	if err != nil {
+		return nil, err
+	}
+	return outcome.removed, nil
+}
+
+// BuildApplyPatch extracts the fields owned by manager from obj, like
+// ExtractManager, as an object ready for a server-side apply with the
+// controller-runtime client:
+//
+//	patchObj, patch, err := r.BuildApplyPatch(ctx, obj, manager)
+//	err = k8sClient.Patch(ctx, patchObj, patch, client.FieldOwner(manager), client.ForceOwnership)
+//
+// The patch is client.Apply, which sends the object itself; the object
+// carries its identity and the keys of every list element it touches. Nulls,
+// which the apiserver would apply as removals, are pruned.
+func (r *Creator) BuildApplyPatch(ctx context.Context, obj *unstructured.Unstructured, manager string) (*unstructured.Unstructured, client.Patch, error) {
+	extracted, err := r.ExtractManager(ctx, obj, manager)
+	if err != nil {
+		return nil, nil, err
+	}
+	patchObj, err := ToUnstructured(extracted)
+	if err != nil {
+		return nil, nil, err
+	}
+	pruneNulls(patchObj.Object)
+	return patchObj, client.Apply, nil
+}
+
+// ToServerSideApplyObject returns the object manager would send to re-apply
+// the fields it owns in obj, as the body of an application/apply-patch+yaml
+// request: the fields of ExtractManager, with obj's identity and the keys of
+// every list element they touch, minus status and the fields Minify strips.
+// Unlike Minify, fields set to their default are kept, as leaving them out
+// of an apply would release manager's ownership of them.
+func (r *Creator) ToServerSideApplyObject(ctx context.Context, obj *unstructured.Unstructured, manager string) (*unstructured.Unstructured, error) {
+	extracted, err := r.ExtractManager(ctx, obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	applyObj, err := ToUnstructured(extracted)
+	if err != nil {
+		return nil, err
+	}
+	strip, err := r.minifyStripSet()
+	if err != nil {
+		return nil, err
+	}
+	strip.Insert(fieldpath.MakePathOrDie("status"))
+	applyObj, err = r.Subtract(ctx, applyObj, strip)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(applyObj.Object)
+	return applyObj, nil
+}
+
+// NeedsUpdate reports whether applying desired would change live, comparing
+// only the fields desired sets: fields found only in live, such as defaults
+// and status, are ignored. It also returns the leaf fields of desired whose
+// value differs from, or is missing in, live. Associative lists and sets are
+// compared by item, so items only live has do not count.
+func (r *Creator) NeedsUpdate(ctx context.Context, live, desired *unstructured.Unstructured) (bool, *fieldpath.Set, error) {
+	if live == nil || desired == nil {
+		return false, nil, fmt.Errorf("live and desired objects cannot be nil")
+	}
+	liveGVK, err := ObjectGVK(live)
+	if err != nil {
+		return false, nil, fmt.Errorf("live: %v", err)
+	}
+	desiredGVK, err := ObjectGVK(desired)
+	if err != nil {
+		return false, nil, fmt.Errorf("desired: %v", err)
+	}
+	if liveGVK != desiredGVK {
+		return false, nil, fmt.Errorf("cannot compare %v with %v", desiredGVK, liveGVK)
+	}
+	liveTV, err := r.typedObject(ctx, withoutManagedFields(live))
+	if err != nil {
+		return false, nil, err
+	}
+	desiredTV, err := r.typedObject(ctx, withoutManagedFields(desired))
+	if err != nil {
+		return false, nil, err
+	}
+	desiredSet, err := desiredTV.ToFieldSet()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to compute desired field set: %v", err)
+	}
+	comparison, err := liveTV.ExtractItems(desiredSet.Leaves()).Compare(desiredTV)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to compare live and desired: %v", err)
+	}
+	changed := comparison.Modified.Union(comparison.Added).Leaves()
+	return !changed.Empty(), changed, nil
+}
+
+// ApplyPreviewManagedFields simulates applying config onto live by manager,
+// like Apply, and returns the managedFields the apiserver would record
+// instead of the object. With force false, conflicts are returned as a
+// *ConflictError.
+func (r *Creator) ApplyPreviewManagedFields(ctx context.Context, live, config *unstructured.Unstructured, manager string, force bool) ([]metav1.ManagedFieldsEntry, error) {
+	outcome, err := r.apply(ctx, live, config, manager, force)
+	if err != nil {
+		return nil, err
+	}
+	if len(outcome.conflicts) > 0 && !force {
+		return nil, &ConflictError{Conflicts: outcome.conflicts}
+	}
+	return outcome.managedFields, nil
+}
+
+// withoutManagedFields returns a copy of obj without metadata.managedFields.
+func withoutManagedFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	return obj
+}
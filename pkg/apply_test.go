@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// issueNodePortConfig changes the nodePort shared by the managers of the
+// TestIssue Service.
+const issueNodePortConfig = `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30002,"port":80,"protocol":"TCP"}]}}`
+
+func managerFieldSet(t *testing.T, obj *unstructured.Unstructured, manager string, op metav1.ManagedFieldsOperationType) *fieldpath.Set {
+	t.Helper()
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == manager && entry.Operation == op {
+			set, err := SetFromManagedField(entry)
+			if err != nil {
+				t.Fatalf("failed to parse managed fields of %v: %v", manager, err)
+			}
+			return set
+		}
+	}
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	live := jsonToUnstructured(issueServiceJSON)
+	config := jsonToUnstructured(issueNodePortConfig)
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")
+
+	_, err := r.Apply(ctx, live, config, "my-applier", false)
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0].Manager != "kubectl-edit" || !conflictErr.Conflicts[0].Path.Equals(nodePort) {
+		t.Errorf("expected a single nodePort conflict with kubectl-edit, got %v", conflictErr.Conflicts)
+	}
+
+	result, err := r.Apply(ctx, live, config, "my-applier", true)
+	if err != nil {
+		t.Fatalf("failed to force apply: %v", err)
+	}
+	ports, _, _ := unstructured.NestedSlice(result.Object, "spec", "ports")
+	if got := ports[0].(map[string]interface{})["nodePort"]; fmt.Sprint(got) != "30002" {
+		t.Errorf("expected nodePort 30002, got %v", got)
+	}
+	if set := managerFieldSet(t, result, "kubectl-edit", metav1.ManagedFieldsOperationUpdate); set != nil {
+		t.Errorf("expected kubectl-edit to lose its only field, still owns %v", set)
+	}
+	if set := managerFieldSet(t, result, "my-applier", metav1.ManagedFieldsOperationApply); set == nil || !set.Has(nodePort) {
+		t.Errorf("expected my-applier to own nodePort, got %v", set)
+	}
+	if set := managerFieldSet(t, result, "kubectl-client-side-apply", metav1.ManagedFieldsOperationUpdate); set == nil || !set.Has(fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "port")) {
+		t.Errorf("expected kubectl-client-side-apply to keep sharing the port key, got %v", set)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	r := newTestCreator(t)
+	live := jsonToUnstructured(issueServiceJSON)
+	// Changes the nodePort, adds a label and adds a second port.
+	config := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service","labels":{"app":"clear-nginx"}},"spec":{"ports":[{"nodePort":30002,"port":80,"protocol":"TCP"},{"port":443,"protocol":"TCP"}]}}`)
+
+	result, err := r.ApplyDryRun(context.Background(), live, config, "my-applier")
+	if err != nil {
+		t.Fatalf("failed to dry-run apply: %v", err)
+	}
+	want := ApplyResult{Added: 3, Changed: 1, Removed: 0}
+	if result.Added != want.Added || result.Changed != want.Changed || result.Removed != want.Removed {
+		t.Errorf("unexpected counts: got %+v, want %+v", result, want)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Manager != "kubectl-edit" {
+		t.Errorf("expected a single conflict with kubectl-edit, got %v", result.Conflicts)
+	}
+}
+
+func TestApplyPreviewManagedFields(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	live := jsonToUnstructured(issueServiceJSON)
+	config := jsonToUnstructured(issueNodePortConfig)
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")
+
+	var conflictErr *ConflictError
+	if _, err := r.ApplyPreviewManagedFields(ctx, live, config, "my-applier", false); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+
+	entries, err := r.ApplyPreviewManagedFields(ctx, live, config, "my-applier", true)
+	if err != nil {
+		t.Fatalf("failed to preview managedFields: %v", err)
+	}
+	var managers []string
+	for _, entry := range entries {
+		managers = append(managers, fmt.Sprintf("%v/%v", entry.Manager, entry.Operation))
+	}
+	if want := "[kubectl-client-side-apply/Update my-applier/Apply]"; fmt.Sprint(managers) != want {
+		t.Errorf("expected entries %v, got %v", want, managers)
+	}
+	set, err := SetFromManagedField(entries[len(entries)-1])
+	if err != nil {
+		t.Fatalf("failed to parse my-applier's fields: %v", err)
+	}
+	if !set.Has(nodePort) {
+		t.Errorf("expected my-applier to own nodePort, got %v", set)
+	}
+	if len(live.GetManagedFields()) != 2 || live.GetManagedFields()[1].Manager != "kubectl-edit" {
+		t.Error("live object was modified")
+	}
+}
+
+func TestNeedsUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	live := jsonToUnstructured(issueServiceJSON)
+
+	matching := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"type":"NodePort","ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`)
+	needed, changed, err := r.NeedsUpdate(ctx, live, matching)
+	if err != nil {
+		t.Fatalf("failed to compare: %v", err)
+	}
+	if needed || !changed.Empty() {
+		t.Errorf("expected no update for fields that already match, got %v", FormatSet(changed))
+	}
+
+	needed, changed, err = r.NeedsUpdate(ctx, live, jsonToUnstructured(issueNodePortConfig))
+	if err != nil {
+		t.Fatalf("failed to compare: %v", err)
+	}
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")
+	if !needed || !changed.Equals(fieldpath.NewSet(nodePort)) {
+		t.Errorf("expected an update of nodePort only, got %v, %v", needed, FormatSet(changed))
+	}
+}
+
+func TestFieldsToRemove(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	live, err := r.Apply(ctx,
+		jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"ClusterIP"}}`),
+		jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"ports":[{"name":"http","port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"}]}}`),
+		"my-applier", false)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	config := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"ports":[{"name":"http","port":80,"protocol":"TCP"}]}}`)
+
+	removed, err := r.FieldsToRemove(ctx, live, config, "my-applier")
+	if err != nil {
+		t.Fatalf("failed to compute removed fields: %v", err)
+	}
+	httpsKey := fieldpath.KeyByFields("port", 443, "protocol", "TCP")
+	want := fieldpath.NewSet(
+		fieldpath.MakePathOrDie("spec", "ports", httpsKey, "name"),
+		fieldpath.MakePathOrDie("spec", "ports", httpsKey, "port"),
+		fieldpath.MakePathOrDie("spec", "ports", httpsKey, "protocol"),
+	)
+	if !removed.Equals(want) {
+		t.Errorf("expected the https port to be removed:\n got: %v\nwant: %v", FormatSet(removed), FormatSet(want))
+	}
+
+	if removed, err = r.FieldsToRemove(ctx, live, config, "other-applier"); err != nil || !removed.Empty() {
+		t.Errorf("expected nothing removed for a manager without an apply entry, got %v, %v", removed, err)
+	}
+}
+
+func TestBuildApplyPatch(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	patchObj, patch, err := r.BuildApplyPatch(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to build apply patch: %v", err)
+	}
+	if patch.Type() != types.ApplyPatchType {
+		t.Errorf("expected an apply patch, got %v", patch.Type())
+	}
+
+	live := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "clear-nginx-service", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, NodePort: 30005}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live).Build()
+	patchObj.SetNamespace("default")
+	if err := c.Patch(ctx, patchObj, patch, client.FieldOwner("kubectl-edit"), client.ForceOwnership); err != nil {
+		t.Fatalf("failed to patch: %v", err)
+	}
+	got := &corev1.Service{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(live), got); err != nil {
+		t.Fatalf("failed to get Service: %v", err)
+	}
+	if len(got.Spec.Ports) != 1 || got.Spec.Ports[0].NodePort != 30001 || got.Spec.Ports[0].Name != "http" {
+		t.Errorf("expected the patch to set nodePort on the existing port, got %+v", got.Spec.Ports)
+	}
+}
+
+func TestBuildApplyPatchPrunesNulls(t *testing.T) {
+	r := newTestCreator(t)
+	patchObj, _, err := r.BuildApplyPatch(context.Background(), jsonToUnstructured(labelOwnerJSON), "labeler")
+	if err != nil {
+		t.Fatalf("failed to build apply patch: %v", err)
+	}
+	if got, want := JsonObjectToString(patchObj.Object), `{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"ClusterIP"}}`; got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestToServerSideApplyObject(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	object.SetUID("0b8c1f6e-5a0e-4e1a-9d3c-1f0c7f1f2b11")
+	object.SetResourceVersion("1234")
+	if err := unstructured.SetNestedSlice(object.Object, []interface{}{map[string]interface{}{"ip": "10.0.0.1"}}, "status", "loadBalancer", "ingress"); err != nil {
+		t.Fatal(err)
+	}
+	object.SetManagedFields(append(object.GetManagedFields(), metav1.ManagedFieldsEntry{
+		Manager:     "kubectl-edit",
+		Operation:   metav1.ManagedFieldsOperationUpdate,
+		APIVersion:  "v1",
+		FieldsType:  "FieldsV1",
+		FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:loadBalancer":{"f:ingress":{}}}}`)},
+		Subresource: "status",
+	}))
+
+	applyObj, err := r.ToServerSideApplyObject(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to build apply object: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(applyObj.Object); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	live := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "clear-nginx-service", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, NodePort: 30005}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live).Build()
+	applyObj.SetNamespace("default")
+	if err := c.Patch(ctx, applyObj, client.Apply, client.FieldOwner("kubectl-edit"), client.ForceOwnership); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	got := &corev1.Service{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(live), got); err != nil {
+		t.Fatalf("failed to get Service: %v", err)
+	}
+	if len(got.Spec.Ports) != 1 || got.Spec.Ports[0].NodePort != 30001 {
+		t.Errorf("expected the apply to set nodePort on the existing port, got %+v", got.Spec.Ports)
+	}
+}
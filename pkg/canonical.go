@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// Canonicalize returns a deterministic JSON encoding of obj, so that objects
+// with the same content encode, and hash, to the same bytes, e.g. to cache by
+// content or detect changes. Map keys are sorted; associative lists are
+// sorted by their keys and sets by value, while atomic lists keep their order
+// as it is meaningful. The defaults declared by the schema are applied, so a
+// field left to its default and one set to it encode alike. managedFields and
+// resourceVersion, which change with every write, are left out.
+func (r *Creator) Canonicalize(ctx context.Context, obj *unstructured.Unstructured) ([]byte, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, err
+	}
+	canonical := obj.DeepCopy()
+	unstructured.RemoveNestedField(canonical.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(canonical.Object, "metadata", "resourceVersion")
+	applyDefaults(s, atom, canonical.Object)
+	sortUnorderedLists(s, atom, canonical.Object)
+	return json.Marshal(canonical.Object)
+}
+
+// sortUnorderedLists sorts, in v, the lists whose order the schema declares
+// meaningless: associative lists by their keys and sets by value. Atomic
+// lists keep their order.
+func sortUnorderedLists(s *mergeDiffSchema.Schema, atom mergeDiffSchema.Atom, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if atom.Map == nil {
+			return
+		}
+		for k, item := range v {
+			tr := atom.Map.ElementType
+			if field, ok := atom.Map.FindField(k); ok {
+				tr = field.Type
+			}
+			if next, ok := s.Resolve(tr); ok {
+				sortUnorderedLists(s, next, item)
+			}
+		}
+	case []interface{}:
+		if atom.List == nil {
+			return
+		}
+		if next, ok := s.Resolve(atom.List.ElementType); ok {
+			for _, item := range v {
+				sortUnorderedLists(s, next, item)
+			}
+		}
+		if atom.List.ElementRelationship != mergeDiffSchema.Associative {
+			return
+		}
+		keys := atom.List.Keys
+		sort.SliceStable(v, func(i, j int) bool {
+			if len(keys) == 0 {
+				return value.Compare(value.NewValueInterface(v[i]), value.NewValueInterface(v[j])) < 0
+			}
+			return compareByKeys(v[i], v[j], keys) < 0
+		})
+	}
+}
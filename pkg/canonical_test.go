@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	a := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","resourceVersion":"1","finalizers":["b","a"]},"spec":{"ports":[{"port":80,"protocol":"TCP","name":"http"},{"port":443,"protocol":"TCP","name":"https"}],"selector":{"app":"web","tier":"frontend"},"clusterIPs":["10.0.0.1","10.0.0.2"]}}`)
+	b := jsonToUnstructured(`{"kind":"Service","apiVersion":"v1","spec":{"clusterIPs":["10.0.0.1","10.0.0.2"],"selector":{"tier":"frontend","app":"web"},"ports":[{"name":"https","protocol":"TCP","port":443},{"name":"http","port":80,"protocol":"TCP"}]},"metadata":{"finalizers":["a","b"],"resourceVersion":"2","name":"web"}}`)
+	b.SetManagedFields(jsonToUnstructured(issueServiceJSON).GetManagedFields())
+
+	aBytes, err := r.Canonicalize(ctx, a)
+	if err != nil {
+		t.Fatalf("failed to canonicalize: %v", err)
+	}
+	bBytes, err := r.Canonicalize(ctx, b)
+	if err != nil {
+		t.Fatalf("failed to canonicalize: %v", err)
+	}
+	if !bytes.Equal(aBytes, bBytes) {
+		t.Errorf("expected identical encodings, got\n%s\n%s", aBytes, bBytes)
+	}
+
+	// clusterIPs is atomic: its order is meaningful.
+	b.Object["spec"].(map[string]interface{})["clusterIPs"] = []interface{}{"10.0.0.2", "10.0.0.1"}
+	if bBytes, err = r.Canonicalize(ctx, b); err != nil {
+		t.Fatalf("failed to canonicalize: %v", err)
+	}
+	if bytes.Equal(aBytes, bBytes) {
+		t.Error("expected reordering an atomic list to change the encoding")
+	}
+}
+
+func TestCanonicalizeDefaults(t *testing.T) {
+	ctx := context.Background()
+	doc := strings.Replace(widgetOpenAPI, `"type": "array",`, `"type": "array", "x-kubernetes-list-type": "map", "x-kubernetes-list-map-keys": ["port", "protocol"],`, 1)
+	r, err := NewFromOpenAPIBytes(ctx, []byte(doc))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	a := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"mode":"auto","ports":[{"port":80},{"port":53,"protocol":"UDP"}]}}`)
+	b := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"ports":[{"port":53,"protocol":"UDP"},{"port":80,"protocol":"TCP"}]}}`)
+
+	aBytes, err := r.Canonicalize(ctx, a)
+	if err != nil {
+		t.Fatalf("failed to canonicalize: %v", err)
+	}
+	bBytes, err := r.Canonicalize(ctx, b)
+	if err != nil {
+		t.Fatalf("failed to canonicalize: %v", err)
+	}
+	want := `{"apiVersion":"example.com/v1","kind":"Widget","spec":{"mode":"auto","ports":[{"port":53,"protocol":"UDP"},{"port":80,"protocol":"TCP"}]}}`
+	if string(aBytes) != want || string(bBytes) != want {
+		t.Errorf("expected both to encode as %v, got\n%s\n%s", want, aBytes, bBytes)
+	}
+}
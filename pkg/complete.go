@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"google.golang.org/protobuf/proto"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// NewComplete builds a Creator like New and additionally registers the
+// schemas of all CRDs installed in the cluster, for the served versions whose
+// schema the apiserver does not publish in /openapi/v2, so built-in and custom
+// resources are handled alike without per-CRD setup. The CRDs are listed
+// again on every schema reload.
+//
+// A CRD whose schema cannot be registered is skipped. If any is, the Creator
+// is returned along with a *CRDRegistrationError listing them; the Creator is
+// usable for everything else.
+//
+// Besides "get" on the /openapi/v2 non-resource URL, which New needs, the
+// credentials of restConfig need "list" on
+// customresourcedefinitions.apiextensions.k8s.io at cluster scope.
+func NewComplete(ctx context.Context, restConfig *rest.Config, opts ...Option) (*Creator, error) {
+	crds, err := apiextensionsclient.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create apiextensions client: %v", err)
+	}
+	src := &crdModelSource{
+		base: discovery.NewDiscoveryClientForConfigOrDie(restConfig),
+		crds: crds,
+	}
+	creator, err := NewFromModelSource(ctx, src, append([]Option{withRestConfig(restConfig)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	if errs := src.registrationErrors(); len(errs) > 0 {
+		return creator, &CRDRegistrationError{Errors: errs}
+	}
+	return creator, nil
+}
+
+// CRDRegistrationError reports the CRDs whose schemas NewComplete could not
+// register, by CRD name.
+type CRDRegistrationError struct {
+	Errors map[string]error
+}
+
+func (e *CRDRegistrationError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%v: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("%d CRD(s) could not be registered: %v", len(names), strings.Join(msgs, "; "))
+}
+
+// crdModelSource adds the schemas of the installed CRDs to the document of
+// base. It records the CRDs that failed on the latest fetch.
+type crdModelSource struct {
+	base ModelSource
+	crds apiextensionsclient.Interface
+
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func (s *crdModelSource) OpenAPISchema() (*openapi_v2.Document, error) {
+	doc, err := s.base.OpenAPISchema()
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.crds.ApiextensionsV1().CustomResourceDefinitions().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CRDs: %v", err)
+	}
+	doc = proto.Clone(doc).(*openapi_v2.Document)
+	if doc.Definitions == nil {
+		doc.Definitions = &openapi_v2.Definitions{}
+	}
+	known := map[string]bool{}
+	for _, def := range doc.Definitions.AdditionalProperties {
+		known[def.Name] = true
+	}
+	errs := map[string]error{}
+	for i := range list.Items {
+		crd := &list.Items[i]
+		defs, err := crdDefinitions(crd, known)
+		if err != nil {
+			errs[crd.Name] = err
+			continue
+		}
+		doc.Definitions.AdditionalProperties = append(doc.Definitions.AdditionalProperties, defs...)
+	}
+	s.mu.Lock()
+	s.errs = errs
+	s.mu.Unlock()
+	return doc, nil
+}
+
+func (s *crdModelSource) registrationErrors() map[string]error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errs
+}
+
+// crdDefinitions converts the schemas of crd's served versions to OpenAPI v2
+// definitions, named as the apiserver names them, skipping those named in
+// known.
+func crdDefinitions(crd *apiextensionsv1.CustomResourceDefinition, known map[string]bool) ([]*openapi_v2.NamedSchema, error) {
+	definitions := map[string]interface{}{}
+	for _, version := range crd.Spec.Versions {
+		if !version.Served {
+			continue
+		}
+		name := crdDefinitionName(crd.Spec.Group, version.Name, crd.Spec.Names.Kind)
+		if known[name] {
+			continue
+		}
+		if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+			return nil, fmt.Errorf("version %v has no schema", version.Name)
+		}
+		b, err := json.Marshal(version.Schema.OpenAPIV3Schema)
+		if err != nil {
+			return nil, fmt.Errorf("version %v: %v", version.Name, err)
+		}
+		var def map[string]interface{}
+		if err := json.Unmarshal(b, &def); err != nil {
+			return nil, fmt.Errorf("version %v: %v", version.Name, err)
+		}
+		toSwaggerSchema(def)
+		if properties, ok := def["properties"].(map[string]interface{}); ok {
+			properties["metadata"] = map[string]interface{}{"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}
+		}
+		def["x-kubernetes-group-version-kind"] = []interface{}{map[string]interface{}{
+			"group":   crd.Spec.Group,
+			"version": version.Name,
+			"kind":    crd.Spec.Names.Kind,
+		}}
+		definitions[name] = def
+	}
+	if len(definitions) == 0 {
+		return nil, nil
+	}
+	// Each CRD is parsed on its own, so a malformed schema only costs that
+	// CRD.
+	b, err := json.Marshal(map[string]interface{}{
+		"swagger":     "2.0",
+		"info":        map[string]interface{}{"title": crd.Name, "version": ""},
+		"paths":       map[string]interface{}{},
+		"definitions": definitions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, err := openapi_v2.ParseDocument(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return doc.Definitions.AdditionalProperties, nil
+}
+
+// crdDefinitionName returns the name the apiserver publishes a CRD version's
+// definition under, e.g. "my.domain.webapp.v1.Guestbook" for the group
+// webapp.my.domain.
+func crdDefinitionName(group, version, kind string) string {
+	parts := strings.Split(group, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(append(parts, version, kind), ".")
+}
+
+// toSwaggerSchema drops the OpenAPI v3 keywords of a CRD schema that OpenAPI
+// v2 lacks, recursively. Like the apiserver does when publishing CRDs, the
+// affected fields are left less constrained rather than rejected.
+func toSwaggerSchema(s map[string]interface{}) {
+	for _, keyword := range []string{"nullable", "oneOf", "anyOf", "not"} {
+		delete(s, keyword)
+	}
+	if properties, ok := s["properties"].(map[string]interface{}); ok {
+		for _, child := range properties {
+			if child, ok := child.(map[string]interface{}); ok {
+				toSwaggerSchema(child)
+			}
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if child, ok := s[key].(map[string]interface{}); ok {
+			toSwaggerSchema(child)
+		}
+	}
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, child := range all {
+			if child, ok := child.(map[string]interface{}); ok {
+				toSwaggerSchema(child)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCRDModelSource(t *testing.T) {
+	ctx := context.Background()
+	guestbook := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "guestbooks.webapp.my.domain"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "webapp.my.domain",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Guestbook"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:   "v1",
+				Served: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"apiVersion": {Type: "string"},
+						"kind":       {Type: "string"},
+						"metadata":   {Type: "object"},
+						"spec": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"foo":      {Type: "string", Nullable: true},
+							"replicas": {Type: "integer"},
+						}},
+					},
+				}},
+			}},
+		},
+	}
+	broken := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "brokens.webapp.my.domain"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    "webapp.my.domain",
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Kind: "Broken"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true}},
+		},
+	}
+	src := &crdModelSource{
+		base: fakeModelSource{doc: testOpenAPIDocument(t)},
+		crds: apiextensionsfake.NewSimpleClientset(guestbook, broken),
+	}
+
+	r, err := NewFromModelSource(ctx, src)
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	gvk := schema.GroupVersionKind{Group: "webapp.my.domain", Version: "v1", Kind: "Guestbook"}
+	obj := jsonToUnstructured(`{
+		"apiVersion": "webapp.my.domain/v1",
+		"kind": "Guestbook",
+		"metadata": {"name": "guestbook", "labels": {"app": "guestbook"}},
+		"spec": {"foo": "bar", "replicas": 2}
+	}`)
+	if _, err := r.ParseableType(ctx, gvk).FromUnstructured(obj.Object); err != nil {
+		t.Errorf("expected the Guestbook schema to be registered: %v", err)
+	}
+
+	errs := src.registrationErrors()
+	if len(errs) != 1 || errs["brokens.webapp.my.domain"] == nil {
+		t.Fatalf("expected a registration error for the broken CRD only, got %v", errs)
+	}
+	if msg := (&CRDRegistrationError{Errors: errs}).Error(); !strings.Contains(msg, "brokens.webapp.my.domain: version v1 has no schema") {
+		t.Errorf("unexpected error message %q", msg)
+	}
+}
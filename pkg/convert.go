@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// ObjectGVK returns the GVK of obj, failing when its apiVersion or kind is
+// missing or its apiVersion is malformed. An apiVersion without a group, like
+// "v1", is of the core group.
+func ObjectGVK(obj *unstructured.Unstructured) (schema.GroupVersionKind, error) {
+	if obj == nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("object cannot be nil")
+	}
+	apiVersion, kind := obj.GetAPIVersion(), obj.GetKind()
+	if apiVersion == "" {
+		return schema.GroupVersionKind{}, fmt.Errorf("object has no apiVersion")
+	}
+	if kind == "" {
+		return schema.GroupVersionKind{}, fmt.Errorf("object has no kind")
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid apiVersion %q: %v", apiVersion, err)
+	}
+	return gv.WithKind(kind), nil
+}
+
+// typedObject converts obj to a TypedValue using the schema for the object's
+// own GVK.
+func (r *Creator) typedObject(ctx context.Context, obj *unstructured.Unstructured) (*typed.TypedValue, error) {
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	objectType := r.ParseableType(ctx, gvk)
+	if objectType == nil {
+		return nil, fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	tv, err := objectType.FromUnstructured(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert object to typed value for GVK %v: %w", gvk, err)
+	}
+	return tv, nil
+}
+
+// ToUnstructured converts a TypedValue back to an unstructured object. A
+// TypedValue holding no value converts to an empty object. Whole numbers in
+// numeric fields of the schema are returned as int64, whatever their original
+// encoding, so a port decoded from JSON as 80.0 comes back as 80.
+func ToUnstructured(tv *typed.TypedValue) (*unstructured.Unstructured, error) {
+	if tv == nil {
+		return nil, fmt.Errorf("typed value cannot be nil")
+	}
+	switch v := withIntegers(tv.Schema(), tv.TypeRef(), tv.AsValue().Unstructured()).(type) {
+	case nil:
+		return &unstructured.Unstructured{Object: map[string]interface{}{}}, nil
+	case map[string]interface{}:
+		return &unstructured.Unstructured{Object: v}, nil
+	default:
+		return nil, fmt.Errorf("typed value is not an object: %T", v)
+	}
+}
+
+// DumpTyped returns tv as a plain map, like ToUnstructured, for structured
+// logging: passed as a logr value it is encoded once, as an object, rather
+// than as a string of JSON. A nil tv is an error rather than a panic.
+func (r *Creator) DumpTyped(tv *typed.TypedValue) (map[string]interface{}, error) {
+	u, err := ToUnstructured(tv)
+	if err != nil {
+		return nil, err
+	}
+	return u.Object, nil
+}
+
+// ToTypedObject decodes tv into out, a Go type registered in client-go's
+// scheme such as *corev1.Service, by way of JSON. It fails when the kind of
+// tv is not one out is registered for.
+func ToTypedObject(tv *typed.TypedValue, out runtime.Object) error {
+	if out == nil {
+		return fmt.Errorf("output object cannot be nil")
+	}
+	u, err := ToUnstructured(tv)
+	if err != nil {
+		return err
+	}
+	gvk, err := ObjectGVK(u)
+	if err != nil {
+		return err
+	}
+	kinds, _, err := scheme.Scheme.ObjectKinds(out)
+	if err != nil {
+		return fmt.Errorf("cannot convert to %T: %v", out, err)
+	}
+	matched := false
+	for _, kind := range kinds {
+		matched = matched || kind == gvk
+	}
+	if !matched {
+		return fmt.Errorf("cannot convert %v to %T, which is %v", gvk, out, kinds)
+	}
+	data, err := json.Marshal(u.Object)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode object into %T: %v", out, err)
+	}
+	return nil
+}
+
+// withIntegers returns a copy of v, of type tr in s, in which the whole
+// float64 values of numeric scalars are replaced by int64. Structured-merge-diff
+// does not tell integers from floats, so JSON-decoded objects hold every
+// number as a float64.
+func withIntegers(s *mergeDiffSchema.Schema, tr mergeDiffSchema.TypeRef, v interface{}) interface{} {
+	atom, ok := s.Resolve(tr)
+	if !ok {
+		return v
+	}
+	switch v := v.(type) {
+	case float64:
+		if atom.Scalar != nil && *atom.Scalar == mergeDiffSchema.Numeric && v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v)
+		}
+	case map[string]interface{}:
+		if atom.Map == nil {
+			return v
+		}
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			itemType := atom.Map.ElementType
+			if field, ok := atom.Map.FindField(k); ok {
+				itemType = field.Type
+			}
+			out[k] = withIntegers(s, itemType, item)
+		}
+		return out
+	case []interface{}:
+		if atom.List == nil {
+			return v
+		}
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = withIntegers(s, atom.List.ElementType, item)
+		}
+		return out
+	}
+	return v
+}
+
+// pruneNulls removes null fields from m, recursing into nested maps and
+// lists. Structured-merge-diff leaves a null behind when it removes every
+// item of a map.
+func pruneNulls(m map[string]interface{}) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			pruneNulls(v)
+		case []interface{}:
+			for _, item := range v {
+				if item, ok := item.(map[string]interface{}); ok {
+					pruneNulls(item)
+				}
+			}
+		}
+	}
+}
+
+// valueAtPath returns the unstructured value found at p in v. List items may
+// be selected by index, key or value.
+func valueAtPath(v interface{}, p fieldpath.Path) (interface{}, bool) {
+	for _, pe := range p {
+		switch {
+		case pe.FieldName != nil:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[*pe.FieldName]; !ok {
+				return nil, false
+			}
+		default:
+			l, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			i := listItemIndex(l, pe)
+			if i < 0 {
+				return nil, false
+			}
+			v = l[i]
+		}
+	}
+	return v, true
+}
+
+// positionalPath returns p with the list items it selects by key or value in
+// v replaced by their index, so that p keeps addressing the same items once
+// their keys or values are changed in place.
+func positionalPath(v interface{}, p fieldpath.Path) (fieldpath.Path, bool) {
+	positional := make(fieldpath.Path, 0, len(p))
+	for _, pe := range p {
+		switch {
+		case pe.FieldName != nil:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[*pe.FieldName]; !ok {
+				return nil, false
+			}
+			positional = append(positional, pe)
+		default:
+			l, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			i := listItemIndex(l, pe)
+			if i < 0 {
+				return nil, false
+			}
+			v = l[i]
+			positional = append(positional, fieldpath.PathElement{Index: &i})
+		}
+	}
+	return positional, true
+}
+
+// listItemIndex returns the index of the first item of l selected by pe, or
+// -1.
+func listItemIndex(l []interface{}, pe fieldpath.PathElement) int {
+	for i, item := range l {
+		switch {
+		case pe.Index != nil:
+			if i == *pe.Index {
+				return i
+			}
+		case pe.Value != nil:
+			if value.Equals(value.NewValueInterface(item), *pe.Value) {
+				return i
+			}
+		case pe.Key != nil:
+			if matchesKey(item, *pe.Key) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// matchesKey reports whether the list item has every field of key set to the
+// key's value.
+func matchesKey(item interface{}, key value.FieldList) bool {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, field := range key {
+		v, ok := m[field.Name]
+		if !ok || !value.Equals(value.NewValueInterface(v), field.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// setValueAtPath replaces the unstructured value found at p in root with v.
+// It reports false if p does not exist in root.
+func setValueAtPath(root interface{}, p fieldpath.Path, v interface{}) bool {
+	if len(p) == 0 {
+		return false
+	}
+	parent, ok := valueAtPath(root, p[:len(p)-1])
+	if !ok {
+		return false
+	}
+	last := p[len(p)-1]
+	if last.FieldName != nil {
+		m, ok := parent.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m[*last.FieldName]; !ok {
+			return false
+		}
+		m[*last.FieldName] = v
+		return true
+	}
+	l, ok := parent.([]interface{})
+	if !ok {
+		return false
+	}
+	i := listItemIndex(l, last)
+	if i < 0 {
+		return false
+	}
+	l[i] = v
+	return true
+}
+
+// hasPathPrefix reports whether p starts with prefix.
+func hasPathPrefix(p, prefix fieldpath.Path) bool {
+	return len(p) >= len(prefix) && p[:len(prefix)].Equals(prefix)
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestObjectGVK(t *testing.T) {
+	tests := map[string]struct {
+		obj     *unstructured.Unstructured
+		want    schema.GroupVersionKind
+		wantErr bool
+	}{
+		"core group": {
+			obj:  jsonToUnstructured(`{"apiVersion":"v1","kind":"Service"}`),
+			want: schema.GroupVersionKind{Version: "v1", Kind: "Service"},
+		},
+		"named group": {
+			obj:  jsonToUnstructured(`{"apiVersion":"apps/v1","kind":"Deployment"}`),
+			want: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		},
+		"empty apiVersion": {
+			obj:     jsonToUnstructured(`{"apiVersion":"","kind":"Service"}`),
+			wantErr: true,
+		},
+		"missing kind": {
+			obj:     jsonToUnstructured(`{"apiVersion":"v1"}`),
+			wantErr: true,
+		},
+		"malformed apiVersion": {
+			obj:     jsonToUnstructured(`{"apiVersion":"apps/v1/beta","kind":"Deployment"}`),
+			wantErr: true,
+		},
+		"nil object": {
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ObjectGVK(test.obj)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDumpTyped(t *testing.T) {
+	r := newTestCreator(t)
+	extracted, err := r.ExtractManager(context.Background(), jsonToUnstructured(issueServiceJSON), "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	dumped, err := r.DumpTyped(extracted)
+	if err != nil {
+		t.Fatalf("failed to dump: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(dumped); got != want {
+		t.Errorf("unexpected dump:\n got: %v\nwant: %v", got, want)
+	}
+	if _, err := r.DumpTyped(nil); err == nil {
+		t.Error("expected an error for a nil typed value")
+	}
+}
@@ -0,0 +1,485 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/kube-openapi/pkg/schemaconv"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+type Creator struct {
+	restConfig *rest.Config
+	src        ModelSource
+
+	// mu guards the schema state below, which is replaced as a whole when
+	// the schema is reloaded.
+	mu               sync.RWMutex
+	gvkToTypeNameMap map[schema.GroupVersionKind]string // Map from gvk to type name.
+	schema           *mergeDiffSchema.Schema
+	models           proto.Models
+	modelCount       int
+	lastSync         time.Time
+	digestOnce       sync.Once
+	digest           string
+
+	discoveryOnce sync.Once
+	discovery     discovery.CachedDiscoveryInterface
+	discoveryErr  error
+
+	// release drops the Creator's reference to a shared schema, see
+	// NewShared.
+	releaseOnce sync.Once
+	release     func()
+
+	typeConverter        TypeConverter
+	deducedFallback      bool
+	contextFields        func(context.Context) []any
+	gvkExtensionKey      string
+	caseInsensitiveKinds bool
+	strictTypeMappings   bool
+	convertWorkers       int
+	explainMaxDepth      int
+	extractCache         *extractCache
+	managedFieldsPolicy  ManagedFieldsPolicy
+	fieldManager         string
+	listSorts            map[string][]string
+	tracer               func(TraceEvent)
+	traceMu              sync.Mutex
+	minifyStrip          []string
+	gvkAliases           map[schema.GroupVersionKind]schema.GroupVersionKind
+	dropDeprecated       bool
+	extractWorkers       int
+}
+
+func New(ctx context.Context, restConfig *rest.Config, opts ...Option) (*Creator, error) {
+	dc := discovery.NewDiscoveryClientForConfigOrDie(restConfig)
+	return NewFromModelSource(ctx, dc, append([]Option{withRestConfig(restConfig)}, opts...)...)
+}
+
+// NewFromOpenAPIBytes builds a Creator from an OpenAPI v2 document in JSON or
+// YAML, e.g. the output of "kubectl get --raw /openapi/v2", without contacting
+// a cluster. Methods that rely on discovery, such as ResourceScope, return an
+// error on such a Creator.
+func NewFromOpenAPIBytes(ctx context.Context, data []byte, opts ...Option) (*Creator, error) {
+	doc, err := openapi_v2.ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %v", err)
+	}
+	return NewFromModelSource(ctx, documentSource{doc: doc}, opts...)
+}
+
+// documentSource serves an OpenAPI document already in memory.
+type documentSource struct {
+	doc *openapi_v2.Document
+}
+
+func (s documentSource) OpenAPISchema() (*openapi_v2.Document, error) {
+	return s.doc, nil
+}
+
+// ModelSource provides the OpenAPI v2 document a Creator is built from and
+// reloads its schema from. A discovery client is one; files, test fixtures or
+// custom aggregators can be others.
+type ModelSource interface {
+	OpenAPISchema() (*openapi_v2.Document, error)
+}
+
+// NewFromModelSource builds a Creator from the OpenAPI document served by
+// src. Methods that rely on discovery, such as ResourceScope, return an error
+// on such a Creator unless it was built by New.
+func NewFromModelSource(ctx context.Context, src ModelSource, opts ...Option) (*Creator, error) {
+	if src == nil {
+		return nil, fmt.Errorf("model source cannot be nil")
+	}
+	creator := &Creator{src: src}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(creator)
+		}
+	}
+	if err := creator.reload(ctx); err != nil {
+		return nil, err
+	}
+	return creator, nil
+}
+
+// reload fetches the OpenAPI document from the Creator's source and swaps in
+// the converted schema. The previous schema is kept if anything fails.
+func (r *Creator) reload(ctx context.Context) error {
+	doc, err := r.src.OpenAPISchema()
+	if err != nil {
+		return err
+	}
+	converted, err := r.convert(ctx, doc)
+	if err != nil {
+		return err
+	}
+	r.install(ctx, converted)
+	return nil
+}
+
+// convertedSchema is the schema state converted from an OpenAPI document.
+// It is never modified once built, so it may be shared between Creators.
+type convertedSchema struct {
+	schema           *mergeDiffSchema.Schema
+	gvkToTypeNameMap map[schema.GroupVersionKind]string
+	models           proto.Models
+	modelCount       int
+}
+
+// convert converts doc to a structured-merge-diff schema and maps the GVKs
+// its models declare to their type names.
+func (r *Creator) convert(ctx context.Context, doc *openapi_v2.Document) (*convertedSchema, error) {
+	log := r.logger(ctx)
+
+	models, err := proto.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, err
+	}
+	modelNames := models.ListModels()
+	if len(modelNames) == 0 {
+		return nil, fmt.Errorf("OpenAPI schema contains no models")
+	}
+
+	typeSchema, err := schemaconv.ToSchemaWithPreserveUnknownFields(models, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert models to schema: %v", err)
+	}
+	r.applyTypeConverter(models, typeSchema)
+
+	// Construct map of GVK to type name. Parseable types expect type name together with schema.
+	gvkExtensionKey := r.gvkExtensionKey
+	if gvkExtensionKey == "" {
+		gvkExtensionKey = defaultGVKExtensionKey
+	}
+	gvkLists, err := modelGVKs(models, modelNames, gvkExtensionKey, r.convertWorkers)
+	if err != nil {
+		return nil, err
+	}
+	gvkToTypeNameMap := make(map[schema.GroupVersionKind]string)
+	for i, modelName := range modelNames {
+		for _, gvk := range gvkLists[i] {
+			if len(gvk.Kind) > 0 {
+				if existingModelName, ok := gvkToTypeNameMap[gvk]; ok {
+					log.Info("duplicate GVK entry in OpenAPI schema", "gvk", gvk,
+						"modelName", modelName, "existingModelName", existingModelName)
+				}
+				gvkToTypeNameMap[gvk] = modelName
+			}
+		}
+	}
+	if len(gvkToTypeNameMap) == 0 {
+		return nil, fmt.Errorf("OpenAPI schema has %d models but none declare a GVK; the document is likely incomplete", len(modelNames))
+	}
+	if r.strictTypeMappings {
+		if dangling := danglingMappings(typeSchema, gvkToTypeNameMap); len(dangling) > 0 {
+			return nil, fmt.Errorf("%d GVK(s) map to types missing from the schema: %v", len(dangling), dangling)
+		}
+	}
+	return &convertedSchema{
+		schema:           typeSchema,
+		gvkToTypeNameMap: gvkToTypeNameMap,
+		models:           models,
+		modelCount:       len(modelNames),
+	}, nil
+}
+
+// modelGVKs returns the GVKs declared by each of modelNames, in the same
+// order. With more than one worker, the models are looked up and parsed
+// concurrently; the result, and the error reported for the first failing
+// model, do not depend on the number of workers.
+func modelGVKs(models proto.Models, modelNames []string, gvkExtensionKey string, workers int) ([][]schema.GroupVersionKind, error) {
+	gvkLists := make([][]schema.GroupVersionKind, len(modelNames))
+	errs := make([]error, len(modelNames))
+	parse := func(i int) {
+		model := models.LookupModel(modelNames[i])
+		if model == nil {
+			errs[i] = fmt.Errorf("ListModels returns a model that can't be looked-up for: %v", modelNames[i])
+			return
+		}
+		gvkLists[i] = parseGroupVersionKind(model, gvkExtensionKey)
+	}
+
+	if workers <= 1 {
+		for i := range modelNames {
+			parse(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < len(modelNames); i += workers {
+					parse(i)
+				}
+			}(w)
+		}
+		wg.Wait()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return gvkLists, nil
+}
+
+// install swaps in converted as the Creator's schema, logging the GVKs added
+// and removed since the previous one.
+func (r *Creator) install(ctx context.Context, converted *convertedSchema) {
+	r.mu.Lock()
+	previous := r.gvkToTypeNameMap
+	r.gvkToTypeNameMap = converted.gvkToTypeNameMap
+	r.schema = converted.schema
+	r.models = converted.models
+	r.modelCount = converted.modelCount
+	r.lastSync = time.Now()
+	r.digestOnce = sync.Once{}
+	r.digest = ""
+	r.mu.Unlock()
+	r.extractCache.purge()
+
+	if previous == nil {
+		return
+	}
+	log := r.logger(ctx)
+	for gvk := range converted.gvkToTypeNameMap {
+		if _, ok := previous[gvk]; !ok {
+			log.Info("GVK added to schema", "gvk", gvk)
+		}
+	}
+	for gvk := range previous {
+		if _, ok := converted.gvkToTypeNameMap[gvk]; !ok {
+			log.Info("GVK removed from schema", "gvk", gvk)
+		}
+	}
+}
+
+// types returns the current schema and GVK map. Reloads replace them rather
+// than modify them, so callers may keep using both.
+func (r *Creator) types() (*mergeDiffSchema.Schema, map[schema.GroupVersionKind]string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.schema, r.gvkToTypeNameMap
+}
+
+// ModelCount returns the number of models in the OpenAPI document the Creator
+// was built from. Callers can use it to sanity-check the document served by
+// minimal clusters.
+func (r *Creator) ModelCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.modelCount
+}
+
+// Models returns the OpenAPI models the current schema was converted from,
+// for information structured-merge-diff types do not carry, such as field
+// descriptions.
+func (r *Creator) Models() proto.Models {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.models
+}
+
+// ResetCaches drops the results the Creator caches on top of its schema: the
+// schema digest, discovery responses and the extractions cached with
+// WithExtractCache. The schema itself is kept. It is safe to call
+// concurrently with other methods.
+func (r *Creator) ResetCaches() {
+	r.mu.Lock()
+	r.digestOnce = sync.Once{}
+	r.digest = ""
+	r.mu.Unlock()
+	r.extractCache.purge()
+
+	if dc, err := r.discoveryClient(); err == nil {
+		dc.Invalidate()
+	}
+}
+
+// logger returns the logger from ctx, with the fields of the configured
+// context fields hook attached when there is a logger to attach them to.
+func (r *Creator) logger(ctx context.Context) logr.Logger {
+	l := log.FromContext(ctx)
+	if r.contextFields == nil || l.GetSink() == nil {
+		return l
+	}
+	if fields := r.contextFields(ctx); len(fields) > 0 {
+		l = l.WithValues(fields...)
+	}
+	return l
+}
+
+// applyTypeConverter replaces the type defs of every model claimed by the
+// configured TypeConverter. Models the converter declines keep the type def
+// produced by schemaconv.
+func (r *Creator) applyTypeConverter(models proto.Models, typeSchema *mergeDiffSchema.Schema) {
+	if r.typeConverter == nil {
+		return
+	}
+
+	index := make(map[string]int, len(typeSchema.Types))
+	for i, typeDef := range typeSchema.Types {
+		index[typeDef.Name] = i
+	}
+	for _, modelName := range models.ListModels() {
+		model := models.LookupModel(modelName)
+		if model == nil {
+			continue
+		}
+		typeDef, ok := r.typeConverter(modelName, model)
+		if !ok {
+			continue
+		}
+		typeDef.Name = modelName
+		if i, ok := index[modelName]; ok {
+			typeSchema.Types[i] = typeDef
+		} else {
+			typeSchema.Types = append(typeSchema.Types, typeDef)
+		}
+	}
+}
+
+// TypeResolver resolves the structured-merge-diff type of a GVK. Creator
+// implements it; code depending on TypeResolver rather than Creator can be
+// tested with a fake such as fake.TypeResolver.
+type TypeResolver interface {
+	ParseableType(ctx context.Context, gvk schema.GroupVersionKind) *typed.ParseableType
+}
+
+var _ TypeResolver = &Creator{}
+
+// ParseableType constructs structured-merge-diff type from GVK. GVKs missing
+// from the schema resolve through their WithGVKAlias alias, if any. It
+// returns nil for GVKs still missing, unless WithDeducedFallback is set.
+func (r *Creator) ParseableType(ctx context.Context, gvk schema.GroupVersionKind) *typed.ParseableType {
+	log := r.logger(ctx)
+
+	typeSchema, gvkToTypeNameMap := r.types()
+	typeName, ok := gvkToTypeNameMap[gvk]
+	if !ok && r.caseInsensitiveKinds {
+		typeName, ok = lookupKindFold(gvkToTypeNameMap, gvk)
+	}
+	if alias, aliased := r.gvkAliases[gvk]; !ok && aliased {
+		log.V(1).Info("No model for GVK, using alias", "gvk", gvk, "alias", alias)
+		typeName, ok = gvkToTypeNameMap[alias]
+	}
+	if !ok {
+		if r.deducedFallback {
+			log.V(1).Info("No model for GVK, using deduced type", "gvk", gvk)
+			deduced := typed.DeducedParseableType
+			return &deduced
+		}
+		return nil
+	}
+	log.V(1).Info("Model for GVK", "gvk", gvk, "typeName", typeName)
+	return &typed.ParseableType{
+		Schema:  typeSchema,
+		TypeRef: mergeDiffSchema.TypeRef{NamedType: &typeName},
+	}
+}
+
+// lookupKindFold finds the type name of gvk in gvkToTypeNameMap, matching the
+// kind case-insensitively. When kinds differing only by case match, the
+// smallest type name wins, so the result does not depend on map order.
+func lookupKindFold(gvkToTypeNameMap map[schema.GroupVersionKind]string, gvk schema.GroupVersionKind) (string, bool) {
+	found := ""
+	for candidate, typeName := range gvkToTypeNameMap {
+		if candidate.GroupVersion() == gvk.GroupVersion() && strings.EqualFold(candidate.Kind, gvk.Kind) {
+			if found == "" || typeName < found {
+				found = typeName
+			}
+		}
+	}
+	return found, found != ""
+}
+
+// ParseableTypeByName constructs a structured-merge-diff type from a type
+// name in the converted schema, bypassing the GVK map. It reaches types that
+// declare no GVK, such as io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta.
+func (r *Creator) ParseableTypeByName(typeName string) (*typed.ParseableType, error) {
+	typeSchema, _ := r.types()
+	if _, ok := typeSchema.FindNamedType(typeName); !ok {
+		return nil, fmt.Errorf("type %v not found in schema", typeName)
+	}
+	return &typed.ParseableType{
+		Schema:  typeSchema,
+		TypeRef: mergeDiffSchema.TypeRef{NamedType: &typeName},
+	}, nil
+}
+
+// defaultGVKExtensionKey is the OpenAPI extension listing the GVKs of a model.
+const defaultGVKExtensionKey = "x-kubernetes-group-version-kind"
+
+// parseGroupVersionKind returns the GVKs declared by s under the extension
+// groupVersionKindExtensionKey.
+func parseGroupVersionKind(s proto.Schema, groupVersionKindExtensionKey string) []schema.GroupVersionKind {
+	extensions := s.GetExtensions()
+
+	gvkListResult := []schema.GroupVersionKind{}
+
+	// Get the extensions
+	gvkExtension, ok := extensions[groupVersionKindExtensionKey]
+	if !ok {
+		return []schema.GroupVersionKind{}
+	}
+
+	// gvk extension must be a list of at least 1 element.
+	gvkList, ok := gvkExtension.([]interface{})
+	if !ok {
+		return []schema.GroupVersionKind{}
+	}
+
+	for _, gvk := range gvkList {
+		// gvk extension list must be a map with group, version, and
+		// kind fields. YAML-decoded documents yield interface{} keys,
+		// JSON-decoded ones string keys.
+		var gvkMap map[string]interface{}
+		switch m := gvk.(type) {
+		case map[string]interface{}:
+			gvkMap = m
+		case map[interface{}]interface{}:
+			gvkMap = make(map[string]interface{}, len(m))
+			for k, v := range m {
+				if k, ok := k.(string); ok {
+					gvkMap[k] = v
+				}
+			}
+		default:
+			continue
+		}
+		group, ok := gvkMap["group"].(string)
+		if !ok {
+			continue
+		}
+		version, ok := gvkMap["version"].(string)
+		if !ok {
+			continue
+		}
+		kind, ok := gvkMap["kind"].(string)
+		if !ok {
+			continue
+		}
+
+		gvkListResult = append(gvkListResult, schema.GroupVersionKind{
+			Group:   group,
+			Version: version,
+			Kind:    kind,
+		})
+	}
+
+	return gvkListResult
+}
@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+)
+
+func newTestCreator(t *testing.T, opts ...Option) *Creator {
+	t.Helper()
+	r, err := New(context.Background(), cfg, opts...)
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	return r
+}
+
+func TestWithTypeConverter(t *testing.T) {
+	const serviceModel = "io.k8s.api.core.v1.Service"
+
+	var called int
+	r := newTestCreator(t, WithTypeConverter(func(modelName string, _ proto.Schema) (mergeDiffSchema.TypeDef, bool) {
+		called++
+		if modelName != serviceModel {
+			return mergeDiffSchema.TypeDef{}, false
+		}
+		return mergeDiffSchema.TypeDef{
+			Atom: mergeDiffSchema.Atom{
+				Map: &mergeDiffSchema.Map{ElementRelationship: mergeDiffSchema.Atomic},
+			},
+		}, true
+	}))
+	if called == 0 {
+		t.Fatal("type converter was never invoked")
+	}
+
+	typeDef, ok := r.schema.FindNamedType(serviceModel)
+	if !ok {
+		t.Fatalf("type %v missing from schema", serviceModel)
+	}
+	if typeDef.Map == nil || typeDef.Map.ElementRelationship != mergeDiffSchema.Atomic {
+		t.Errorf("expected %v to be converted to an atomic map, got %+v", serviceModel, typeDef.Atom)
+	}
+	if _, ok := r.schema.FindNamedType("io.k8s.api.core.v1.ServiceSpec"); !ok {
+		t.Error("models declined by the converter should keep the default conversion")
+	}
+
+	// A nil converter must be ignored.
+	newTestCreator(t, WithTypeConverter(nil))
+}
+
+type fakeModelSource struct {
+	doc *openapi_v2.Document
+}
+
+func (f fakeModelSource) OpenAPISchema() (*openapi_v2.Document, error) {
+	return f.doc, nil
+}
+
+func TestNewRejectsEmptyDocument(t *testing.T) {
+	_, err := NewFromModelSource(context.Background(), fakeModelSource{doc: &openapi_v2.Document{}})
+	if err == nil {
+		t.Fatal("expected an error for an empty OpenAPI document")
+	}
+
+	if r := newTestCreator(t); r.ModelCount() == 0 {
+		t.Error("expected a non-zero model count for a live cluster")
+	}
+}
+
+func TestNewFromModelSource(t *testing.T) {
+	ctx := context.Background()
+	r, err := NewFromModelSource(ctx, fakeModelSource{doc: testOpenAPIDocument(t)}, WithCaseInsensitiveKinds(true))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	if r.ParseableType(ctx, schema.GroupVersionKind{Version: "v1", Kind: "service"}) == nil {
+		t.Error("expected the Service type, with the options applied")
+	}
+	if _, err := r.ResourceScope(serviceGVK); err == nil {
+		t.Error("expected discovery to be unavailable without a rest config")
+	}
+	if _, err := NewFromModelSource(ctx, nil); err == nil {
+		t.Error("expected an error for a nil model source")
+	}
+}
+
+func TestWithDeducedFallback(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+	if newTestCreator(t).ParseableType(ctx, gvk) != nil {
+		t.Fatal("expected no type for an unknown GVK without the fallback")
+	}
+
+	objectType := newTestCreator(t, WithDeducedFallback(true)).ParseableType(ctx, gvk)
+	if objectType == nil {
+		t.Fatal("expected a deduced type for an unknown GVK")
+	}
+	base, err := objectType.FromUnstructured(jsonToInterface(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"size":1,"color":"red"}}`))
+	if err != nil {
+		t.Fatalf("failed to parse base: %v", err)
+	}
+	overlay, err := objectType.FromUnstructured(jsonToInterface(`{"spec":{"size":2}}`))
+	if err != nil {
+		t.Fatalf("failed to parse overlay: %v", err)
+	}
+	merged, err := base.Merge(overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"size":2,"color":"red"}}`)
+	if got := merged.AsValue().Unstructured(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected merge result:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestWithGVKAlias(t *testing.T) {
+	ctx := context.Background()
+	vendored := schema.GroupVersionKind{Group: "vendor.example.com", Version: "v1", Kind: "Service"}
+	r := newTestCreator(t, WithGVKAlias(vendored, serviceGVK))
+
+	objectType := r.ParseableType(ctx, vendored)
+	want := r.ParseableType(ctx, serviceGVK)
+	if objectType == nil || !objectType.TypeRef.Equals(&want.TypeRef) {
+		t.Fatalf("expected %v to resolve to the Service type, got %v", vendored, objectType)
+	}
+
+	object := jsonToUnstructured(issueServiceJSON)
+	object.SetAPIVersion(vendored.GroupVersion().String())
+	extracted, err := r.ExtractManager(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract aliased object: %v", err)
+	}
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); !strings.Contains(got, `"nodePort":30001,"port":80,"protocol":"TCP"`) {
+		t.Errorf("expected the list keys to be extracted through the alias, got %v", got)
+	}
+
+	if newTestCreator(t).ParseableType(ctx, vendored) != nil {
+		t.Error("expected no type for the GVK without the alias")
+	}
+}
+
+type reconcileIDKey struct{}
+
+func TestWithContextFields(t *testing.T) {
+	var out strings.Builder
+	logger := funcr.New(func(prefix, args string) {
+		out.WriteString(args + "\n")
+	}, funcr.Options{Verbosity: 1})
+	ctx := log.IntoContext(context.WithValue(context.Background(), reconcileIDKey{}, "abc123"), logger)
+
+	r := newTestCreator(t, WithContextFields(func(ctx context.Context) []any {
+		return []any{"reconcileID", ctx.Value(reconcileIDKey{})}
+	}))
+	if r.ParseableType(ctx, serviceGVK) == nil {
+		t.Fatal("expected a type for Service")
+	}
+	if !strings.Contains(out.String(), `"reconcileID"="abc123"`) {
+		t.Errorf("expected the reconcile ID in the log output, got:\n%s", out.String())
+	}
+}
+
+// testOpenAPIDocument fetches the test cluster's OpenAPI document.
+func testOpenAPIDocument(b testing.TB) *openapi_v2.Document {
+	b.Helper()
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		b.Fatalf("failed to create discovery client: %v", err)
+	}
+	doc, err := dc.OpenAPISchema()
+	if err != nil {
+		b.Fatalf("failed to fetch OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+func TestWithConcurrentSchemaConvert(t *testing.T) {
+	r := newTestCreator(t)
+	concurrent := newTestCreator(t, WithConcurrentSchemaConvert(4))
+
+	_, want := r.types()
+	_, got := concurrent.types()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the same GVK map as a sequential conversion, got %d entries, want %d", len(got), len(want))
+	}
+}
+
+func TestResetCaches(t *testing.T) {
+	ctx := context.Background()
+	// The tracer reports the extractions the cache does not serve.
+	extractions := 0
+	r := newTestCreator(t, WithExtractCache(4), WithTrace(func(event TraceEvent) {
+		if event.Type == TraceExtractStart {
+			extractions++
+		}
+	}))
+	object := jsonToUnstructured(issueServiceJSON)
+	digest := r.SchemaDigest()
+	if _, err := r.ResourceScope(serviceGVK); err != nil {
+		t.Fatalf("failed to look up resource scope: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.ExtractManager(ctx, object, "kubectl-edit"); err != nil {
+			t.Fatalf("failed to extract: %v", err)
+		}
+	}
+	if extractions != 1 {
+		t.Fatalf("expected the second extraction to hit the cache, got %d extractions", extractions)
+	}
+
+	r.ResetCaches()
+	if _, err := r.ExtractManager(ctx, object, "kubectl-edit"); err != nil {
+		t.Fatalf("failed to extract after reset: %v", err)
+	}
+	if extractions != 2 {
+		t.Errorf("expected a cache miss after the reset, got %d extractions", extractions)
+	}
+	if got := r.SchemaDigest(); got != digest {
+		t.Errorf("expected the recomputed digest to match, got %v want %v", got, digest)
+	}
+	if _, err := r.ResourceScope(serviceGVK); err != nil {
+		t.Errorf("failed to look up resource scope after reset: %v", err)
+	}
+}
+
+func TestParseableTypeByName(t *testing.T) {
+	r := newTestCreator(t)
+
+	objectType, err := r.ParseableTypeByName("io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta")
+	if err != nil {
+		t.Fatalf("failed to get type: %v", err)
+	}
+	if _, err := objectType.FromUnstructured(jsonToInterface(`{"name":"web","labels":{"app":"web"}}`)); err != nil {
+		t.Errorf("failed to parse metadata: %v", err)
+	}
+	if _, err := objectType.FromUnstructured(jsonToInterface(`{"labels":"web"}`)); err == nil {
+		t.Error("expected metadata with malformed labels to be rejected")
+	}
+
+	if _, err := r.ParseableTypeByName("io.k8s.api.core.v1.Widget"); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
+
+func TestParseGroupVersionKindMapShapes(t *testing.T) {
+	want := []schema.GroupVersionKind{{Group: "apps", Version: "v1", Kind: "Deployment"}}
+	for name, gvk := range map[string]interface{}{
+		"yaml": map[interface{}]interface{}{"group": "apps", "version": "v1", "kind": "Deployment"},
+		"json": map[string]interface{}{"group": "apps", "version": "v1", "kind": "Deployment"},
+	} {
+		model := &proto.Kind{BaseSchema: proto.BaseSchema{Extensions: map[string]interface{}{
+			"x-kubernetes-group-version-kind": []interface{}{gvk},
+		}}}
+		if got := parseGroupVersionKind(model, defaultGVKExtensionKey); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestWithGVKExtensionKey(t *testing.T) {
+	ctx := context.Background()
+	doc := strings.Replace(widgetOpenAPI, defaultGVKExtensionKey, "x-vendor-group-version-kind", 1)
+
+	if _, err := NewFromOpenAPIBytes(ctx, []byte(doc)); err == nil {
+		t.Fatal("expected no GVK to be found under the default key")
+	}
+	r, err := NewFromOpenAPIBytes(ctx, []byte(doc), WithGVKExtensionKey("x-vendor-group-version-kind"))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	if r.ParseableType(ctx, widgetGVK) == nil {
+		t.Error("expected Widget to be found under the custom key")
+	}
+}
+
+func TestWithCaseInsensitiveKinds(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "service"}
+
+	if newTestCreator(t).ParseableType(ctx, gvk) != nil {
+		t.Error("expected no type for a lowercase kind by default")
+	}
+	objectType := newTestCreator(t, WithCaseInsensitiveKinds(true)).ParseableType(ctx, gvk)
+	if objectType == nil || *objectType.TypeRef.NamedType != "io.k8s.api.core.v1.Service" {
+		t.Errorf("expected service to resolve to the Service type, got %v", objectType)
+	}
+
+	// Two kinds differing only by case resolve deterministically, and exact
+	// matches still win.
+	doc := strings.Replace(widgetOpenAPI, `"definitions": {`, `"definitions": {
+    "com.example.v1.AWidget": {
+      "type": "object",
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "WIDGET"}],
+      "properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}}
+    },`, 1)
+	r, err := NewFromOpenAPIBytes(ctx, []byte(doc), WithCaseInsensitiveKinds(true))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		folded := r.ParseableType(ctx, schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "widget"})
+		if folded == nil || *folded.TypeRef.NamedType != "com.example.v1.AWidget" {
+			t.Fatalf("expected widget to resolve to the smallest type name, got %v", folded)
+		}
+	}
+	if exact := r.ParseableType(ctx, widgetGVK); exact == nil || *exact.TypeRef.NamedType != "com.example.v1.Widget" {
+		t.Errorf("expected Widget to resolve exactly, got %v", exact)
+	}
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+)
+
+// ApplyDefaults returns a copy of obj in which the fields its schema declares
+// a default for are set to that default when absent, like the apiserver does
+// on create. Defaults are only applied within objects present in obj; a
+// missing spec is not created to hold defaulted fields. Fields set to null
+// are left alone.
+func (r *Creator) ApplyDefaults(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, err
+	}
+	defaulted := obj.DeepCopy()
+	applyDefaults(s, atom, defaulted.Object)
+	return defaulted, nil
+}
+
+// applyDefaults sets the defaults declared by atom, and by the types of the
+// fields and items below it, in v.
+func applyDefaults(s *mergeDiffSchema.Schema, atom mergeDiffSchema.Atom, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if atom.Map == nil {
+			return
+		}
+		for _, field := range atom.Map.Fields {
+			if _, ok := v[field.Name]; !ok && field.Default != nil {
+				v[field.Name] = jsonDefault(field.Default)
+			}
+		}
+		for k, item := range v {
+			tr := atom.Map.ElementType
+			if field, ok := atom.Map.FindField(k); ok {
+				tr = field.Type
+			}
+			if next, ok := s.Resolve(tr); ok {
+				applyDefaults(s, next, item)
+			}
+		}
+	case []interface{}:
+		if atom.List == nil {
+			return
+		}
+		next, ok := s.Resolve(atom.List.ElementType)
+		if !ok {
+			return
+		}
+		for _, item := range v {
+			applyDefaults(s, next, item)
+		}
+	}
+}
+
+// jsonDefault returns a copy of the schema default def made of JSON-compatible
+// values. Defaults decoded from YAML may hold map[interface{}]interface{} and
+// int values.
+func jsonDefault(def interface{}) interface{} {
+	switch def := def.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(def))
+		for k, v := range def {
+			out[fmt.Sprint(k)] = jsonDefault(v)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(def))
+		for k, v := range def {
+			out[k] = jsonDefault(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(def))
+		for i, v := range def {
+			out[i] = jsonDefault(v)
+		}
+		return out
+	case int:
+		return int64(def)
+	case int32:
+		return int64(def)
+	case float32:
+		return float64(def)
+	default:
+		return def
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	r := newWidgetCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"size":1,"ports":[{"port":80},{"port":53,"protocol":"UDP"}]}}`)
+
+	defaulted, err := r.ApplyDefaults(context.Background(), object)
+	if err != nil {
+		t.Fatalf("failed to apply defaults: %v", err)
+	}
+	want := `{"apiVersion":"example.com/v1","kind":"Widget","spec":{"mode":"auto","ports":[{"port":80,"protocol":"TCP"},{"port":53,"protocol":"UDP"}],"size":1}}`
+	if got := JsonObjectToString(defaulted.Object); got != want {
+		t.Errorf("unexpected defaulted object:\n got: %v\nwant: %v", got, want)
+	}
+	if _, ok := object.Object["spec"].(map[string]interface{})["mode"]; ok {
+		t.Error("object was modified")
+	}
+
+	bare := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget"}`)
+	if defaulted, err = r.ApplyDefaults(context.Background(), bare); err != nil {
+		t.Fatalf("failed to apply defaults: %v", err)
+	}
+	if _, ok := defaulted.Object["spec"]; ok {
+		t.Errorf("expected no spec to be created, got %v", defaulted.Object)
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+// ExtractNonDeprecated extracts the fields owned by manager like
+// ExtractManager and also returns the owned fields the OpenAPI document marks
+// as deprecated, in the FormatPath syntax and sorted. Kubernetes marks them in
+// their description, e.g. "Deprecated: Use serviceAccountName instead."; the
+// outermost deprecated field of a path is reported. With
+// WithDropDeprecated, those fields are also left out of the extraction.
+// Types without an OpenAPI model, such as deduced ones, have no deprecated
+// fields.
+func (r *Creator) ExtractNonDeprecated(ctx context.Context, obj *unstructured.Unstructured, manager string) (*typed.TypedValue, []string, error) {
+	extracted, used, err := r.ExtractManagerFull(ctx, obj, manager)
+	if err != nil {
+		return nil, nil, err
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	pt := r.ParseableType(ctx, gvk)
+	models := r.Models()
+	if pt == nil || pt.TypeRef.NamedType == nil || models == nil {
+		return extracted, nil, nil
+	}
+	model := models.LookupModel(*pt.TypeRef.NamedType)
+	if model == nil {
+		return extracted, nil, nil
+	}
+
+	deprecated := fieldpath.NewSet()
+	used.Iterate(func(p fieldpath.Path) {
+		if prefix, ok := deprecatedPrefix(model, p); ok {
+			deprecated.Insert(prefix)
+		}
+	})
+	if deprecated.Empty() {
+		return extracted, nil, nil
+	}
+	var paths []string
+	deprecated.Iterate(func(p fieldpath.Path) {
+		paths = append(paths, FormatPath(p))
+	})
+	sort.Strings(paths)
+	if r.dropDeprecated {
+		extracted = extracted.RemoveItems(deprecated)
+	}
+	return extracted, paths, nil
+}
+
+// deprecatedPrefix returns the shortest prefix of p naming a deprecated
+// field of model, if any.
+func deprecatedPrefix(model proto.Schema, p fieldpath.Path) (fieldpath.Path, bool) {
+	current := model
+	for i, pe := range p {
+		current = resolveModel(current)
+		var next proto.Schema
+		switch {
+		case pe.FieldName != nil:
+			switch s := current.(type) {
+			case *proto.Kind:
+				next = s.Fields[*pe.FieldName]
+			case *proto.Map:
+				next = s.SubType
+			}
+		default:
+			if s, ok := current.(*proto.Array); ok {
+				next = s.SubType
+			}
+		}
+		if next == nil {
+			return nil, false
+		}
+		if pe.FieldName != nil && isDeprecated(next) {
+			return p[:i+1].Copy(), true
+		}
+		current = next
+	}
+	return nil, false
+}
+
+// resolveModel follows references until a schema that is not one.
+func resolveModel(s proto.Schema) proto.Schema {
+	for {
+		ref, ok := s.(proto.Reference)
+		if !ok {
+			return s
+		}
+		s = ref.SubSchema()
+	}
+}
+
+// isDeprecated reports whether the description of a field marks it as
+// deprecated, following the Kubernetes API conventions.
+func isDeprecated(s proto.Schema) bool {
+	description := s.GetDescription()
+	return strings.HasPrefix(description, "Deprecated") || strings.Contains(description, "Deprecated:")
+}
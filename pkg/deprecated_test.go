@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const deprecatedPodJSON = `{
+	"apiVersion": "v1",
+	"kind": "Pod",
+	"metadata": {
+		"name": "app",
+		"managedFields": [{
+			"apiVersion": "v1",
+			"fieldsType": "FieldsV1",
+			"fieldsV1": {"f:spec": {"f:serviceAccount": {}, "f:serviceAccountName": {}, "f:containers": {"k:{\"name\":\"app\"}": {".": {}, "f:name": {}, "f:image": {}}}}},
+			"manager": "legacy-tool",
+			"operation": "Apply"
+		}]
+	},
+	"spec": {
+		"serviceAccount": "builder",
+		"serviceAccountName": "builder",
+		"containers": [{"name": "app", "image": "nginx"}]
+	}
+}`
+
+func TestExtractNonDeprecated(t *testing.T) {
+	ctx := context.Background()
+	object := jsonToUnstructured(deprecatedPodJSON)
+
+	extracted, deprecated, err := newTestCreator(t).ExtractNonDeprecated(ctx, object, "legacy-tool")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if want := []string{".spec.serviceAccount"}; !reflect.DeepEqual(deprecated, want) {
+		t.Errorf("expected deprecated fields %v, got %v", want, deprecated)
+	}
+	want := `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"app"},"spec":{"containers":[{"image":"nginx","name":"app"}],"serviceAccount":"builder","serviceAccountName":"builder"}}`
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	extracted, _, err = newTestCreator(t, WithDropDeprecated(true)).ExtractNonDeprecated(ctx, object, "legacy-tool")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want = `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"app"},"spec":{"containers":[{"image":"nginx","name":"app"}],"serviceAccountName":"builder"}}`
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// diffContext is the number of unchanged lines shown around each change by
+// UnifiedDiff.
+const diffContext = 3
+
+// UnifiedDiff returns a unified diff of the YAML of before and after, e.g. of
+// an object before and after a merge, for display. Both objects are read
+// through their schema, so numbers are rendered consistently, and map keys
+// are sorted, so the diff only shows actual changes. managedFields are left
+// out. The diff is empty when the objects are the same.
+func (r *Creator) UnifiedDiff(ctx context.Context, before, after *unstructured.Unstructured) (string, error) {
+	beforeYAML, err := r.canonicalYAML(ctx, before)
+	if err != nil {
+		return "", fmt.Errorf("before: %v", err)
+	}
+	afterYAML, err := r.canonicalYAML(ctx, after)
+	if err != nil {
+		return "", fmt.Errorf("after: %v", err)
+	}
+	return unifiedDiff(splitLines(beforeYAML), splitLines(afterYAML)), nil
+}
+
+// canonicalYAML renders obj, without managedFields, as YAML with sorted keys.
+func (r *Creator) canonicalYAML(ctx context.Context, obj *unstructured.Unstructured) (string, error) {
+	tv, err := r.typedObject(ctx, withoutManagedFields(obj))
+	if err != nil {
+		return "", err
+	}
+	u, err := ToUnstructured(tv)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(u.Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal object: %v", err)
+	}
+	return string(b), nil
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLine is a line of a diff, prefixed by ' ', '-' or '+'.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the unified diff turning a into b, computed from their
+// longest common subsequence.
+func unifiedDiff(a, b []string) string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	// oldLine and newLine count the lines of a and b before lines[k].
+	oldLine, newLine := 0, 0
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			oldLine++
+			newLine++
+			k++
+			continue
+		}
+		// Extend the hunk while the next change is close enough for the
+		// contexts to touch.
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		if end += diffContext; end > len(lines) {
+			end = len(lines)
+		}
+
+		oldStart, newStart := oldLine-(k-start), newLine-(k-start)
+		var oldCount, newCount int
+		var body strings.Builder
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+			body.WriteByte(l.op)
+			body.WriteString(l.text)
+			body.WriteByte('\n')
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("--- before\n+++ after\n")
+		}
+		fmt.Fprintf(&sb, "@@ -%v +%v @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		sb.WriteString(body.String())
+
+		for _, l := range lines[k:end] {
+			if l.op != '+' {
+				oldLine++
+			}
+			if l.op != '-' {
+				newLine++
+			}
+		}
+		k = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the range of a hunk header for count lines following the
+// first start lines of a file.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
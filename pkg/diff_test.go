@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	before := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","labels":{"app":"web"}},"spec":{"type":"ClusterIP","ports":[{"name":"http","port":80,"protocol":"TCP"}],"selector":{"app":"web"}}}`)
+	after, err := r.MergeObjects(ctx, before, jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"NodePort","ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`))
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+
+	diff, err := r.UnifiedDiff(ctx, before, after)
+	if err != nil {
+		t.Fatalf("failed to diff: %v", err)
+	}
+	want := `--- before
++++ after
+@@ -7,8 +7,9 @@
+ spec:
+   ports:
+   - name: http
++    nodePort: 30001
+     port: 80
+     protocol: TCP
+   selector:
+     app: web
+-  type: ClusterIP
++  type: NodePort
+`
+	if diff != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff, want)
+	}
+
+	if diff, err := r.UnifiedDiff(ctx, before, before); err != nil || diff != "" {
+		t.Errorf("expected no diff between identical objects, got %q, %v", diff, err)
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	b := []string{"1", "two", "3", "4", "5", "6", "7", "8", "9", "10", "11"}
+	want := `--- before
++++ after
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -9,4 +9,3 @@
+ 9
+ 10
+ 11
+-12
+`
+	if got := unifiedDiff(a, b); got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// ServerDryRunApply sends obj to the cluster as a server-side apply by
+// manager with dryRun=All and returns the object the apiserver would store,
+// managedFields included. Nothing is persisted. It gives the ground truth to
+// compare Apply against. Namespaced objects without a namespace are sent to
+// "default". Conflicts are returned as the apiserver reports them. It fails
+// for Creators without a rest config, such as those built by
+// NewFromOpenAPIBytes.
+func (r *Creator) ServerDryRunApply(ctx context.Context, obj *unstructured.Unstructured, manager string) (*unstructured.Unstructured, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	if r.restConfig == nil {
+		return nil, fmt.Errorf("server-side dry-run requires a rest config")
+	}
+	dc, err := r.discoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := restmapper.NewDeferredDiscoveryRESTMapper(dc).RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource for GVK %v: %v", gvk, err)
+	}
+	client, err := dynamic.NewForConfig(r.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	var resource dynamic.ResourceInterface = client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		resource = client.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	data, err := json.Marshal(withoutManagedFields(obj).Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal object: %v", err)
+	}
+	result, err := resource.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: manager,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("server-side dry-run apply of %v %q failed: %v", gvk, obj.GetName(), err)
+	}
+	return result, nil
+}
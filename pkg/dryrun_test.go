@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServerDryRunApplyOffline(t *testing.T) {
+	r := newWidgetCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"spec":{"size":1}}`)
+
+	if _, err := r.ServerDryRunApply(context.Background(), object, "my-applier"); err == nil {
+		t.Error("expected an error for a Creator without a rest config")
+	}
+}
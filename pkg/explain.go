@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// Explain renders obj as an indented tree annotated with its schema in the
+// type for gvk, for debugging merges: every field and list item is followed
+// by its kind in angle brackets, e.g. "<list, associative(port,protocol)>",
+// "<map, preserves unknown fields>" or "<scalar string, default>" for a value
+// equal to its schema default. List items are labelled like the path
+// elements of managedFields. Subtrees below the depth set by
+// WithExplainMaxDepth are elided as "...".
+func (r *Creator) Explain(gvk schema.GroupVersionKind, obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", fmt.Errorf("object cannot be nil")
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return "", err
+	}
+	_, gvkToTypeNameMap := r.types()
+	e := &explainer{
+		walker:   typedWalker{schema: s},
+		maxDepth: r.explainMaxDepth,
+	}
+	fmt.Fprintf(&e.out, "%v (%v) <%v>\n", gvk.Kind, gvkToTypeNameMap[gvk], describeAtom(atom))
+	if err := e.explainChildren(atom, obj.Object, 1); err != nil {
+		return "", err
+	}
+	return e.out.String(), nil
+}
+
+type explainer struct {
+	walker   typedWalker
+	maxDepth int
+	out      strings.Builder
+}
+
+// explainChildren writes the fields or items of v, of type atom, at depth.
+func (e *explainer) explainChildren(atom mergeDiffSchema.Atom, v interface{}, depth int) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if atom.Map == nil || len(v) == 0 {
+			return nil
+		}
+		if e.maxDepth > 0 && depth > e.maxDepth {
+			e.line(depth, "...")
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			tr := atom.Map.ElementType
+			var def interface{}
+			if field, ok := atom.Map.FindField(k); ok {
+				tr, def = field.Type, field.Default
+			}
+			if err := e.explainValue(k, tr, def, v[k], depth); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if atom.List == nil || len(v) == 0 {
+			return nil
+		}
+		if e.maxDepth > 0 && depth > e.maxDepth {
+			e.line(depth, "...")
+			return nil
+		}
+		for i, item := range v {
+			label := fmt.Sprintf("[%d]", i)
+			if atom.List.ElementRelationship != mergeDiffSchema.Atomic {
+				pe, err := e.walker.listItemPathElement(atom.List, value.NewValueInterface(item))
+				if err != nil {
+					return fmt.Errorf("element %d: %v", i, err)
+				}
+				label = FormatPath(fieldpath.Path{pe})
+			}
+			if err := e.explainValue(label, atom.List.ElementType, nil, item, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// explainValue writes the line for v, of type tr and labelled label, followed
+// by its children. def is the schema default of v, if any.
+func (e *explainer) explainValue(label string, tr mergeDiffSchema.TypeRef, def, v interface{}, depth int) error {
+	atom, ok := e.walker.schema.Resolve(tr)
+	if !ok {
+		return fmt.Errorf("%v: unresolvable type reference", label)
+	}
+	description := describeAtom(atom)
+	if def != nil && fmt.Sprint(jsonDefault(def)) == fmt.Sprint(v) {
+		description += ", default"
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		e.line(depth, fmt.Sprintf("%v <%v>", label, description))
+		return e.explainChildren(atom, v, depth+1)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("%v: %v", label, err)
+		}
+		e.line(depth, fmt.Sprintf("%v: %s <%v>", label, b, description))
+		return nil
+	}
+}
+
+func (e *explainer) line(depth int, s string) {
+	e.out.WriteString(strings.Repeat("  ", depth))
+	e.out.WriteString(s)
+	e.out.WriteByte('\n')
+}
+
+// describeAtom summarizes the kind of values atom describes.
+func describeAtom(atom mergeDiffSchema.Atom) string {
+	var kinds []string
+	if atom.Scalar != nil {
+		kinds = append(kinds, fmt.Sprintf("scalar %v", *atom.Scalar))
+	}
+	if atom.List != nil {
+		kinds = append(kinds, fmt.Sprintf("list, %v", listRelationship(atom.List)))
+	}
+	if atom.Map != nil {
+		switch {
+		case preservesUnknownFields(atom):
+			kinds = append(kinds, "map, preserves unknown fields")
+		case atom.Map.ElementRelationship == mergeDiffSchema.Atomic:
+			kinds = append(kinds, "map, atomic")
+		default:
+			kinds = append(kinds, "map")
+		}
+	}
+	if len(kinds) == 0 {
+		return "unknown"
+	}
+	return strings.Join(kinds, " | ")
+}
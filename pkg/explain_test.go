@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	object := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"mode":"auto","size":2,"ports":[{"port":80,"protocol":"TCP"}],"config":{"a":{"b":1}}}}`)
+
+	explained, err := newWidgetCreator(t).Explain(widgetGVK, object)
+	if err != nil {
+		t.Fatalf("failed to explain: %v", err)
+	}
+	for _, want := range []string{
+		"Widget (com.example.v1.Widget) <map>\n",
+		"  spec <map>\n",
+		"    config <map, preserves unknown fields>\n",
+		`    mode: "auto" <scalar string, default>` + "\n",
+		"    ports <list, atomic>\n",
+		`        protocol: "TCP" <scalar string, default>` + "\n",
+		"    size: 2 <scalar numeric>\n",
+	} {
+		if !strings.Contains(explained, want) {
+			t.Errorf("expected %q in:\n%s", want, explained)
+		}
+	}
+
+	shallow, err := newWidgetCreator(t, WithExplainMaxDepth(1)).Explain(widgetGVK, object)
+	if err != nil {
+		t.Fatalf("failed to explain: %v", err)
+	}
+	if want := "Widget (com.example.v1.Widget) <map>\n  apiVersion: \"example.com/v1\" <scalar string>\n  kind: \"Widget\" <scalar string>\n  spec <map>\n    ...\n"; shallow != want {
+		t.Errorf("unexpected shallow explanation:\n%s\nwant:\n%s", shallow, want)
+	}
+}
+
+func TestExplainAssociativeList(t *testing.T) {
+	r := newTestCreator(t)
+	explained, err := r.Explain(serviceGVK, jsonToUnstructured(issueServiceJSON))
+	if err != nil {
+		t.Fatalf("failed to explain: %v", err)
+	}
+	for _, want := range []string{
+		"    ports <list, associative(port,protocol)>\n",
+		`      [port=80,protocol="TCP"] <map>` + "\n",
+		"        nodePort: 30001 <scalar numeric>\n",
+	} {
+		if !strings.Contains(explained, want) {
+			t.Errorf("expected %q in:\n%s", want, explained)
+		}
+	}
+}
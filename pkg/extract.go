@@ -0,0 +1,734 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+	"sigs.k8s.io/yaml"
+)
+
+// identityFields identify an object and are kept in every extraction so the
+// result can be applied on its own.
+var identityFields = fieldpath.NewSet(
+	fieldpath.MakePathOrDie("apiVersion"),
+	fieldpath.MakePathOrDie("kind"),
+	fieldpath.MakePathOrDie("metadata", "name"),
+	fieldpath.MakePathOrDie("metadata", "namespace"),
+)
+
+// SetFromManagedField parses the fieldset recorded in a managed fields entry.
+// Besides the JSON object returned by the API, fieldsV1 may hold that object
+// encoded as a JSON string, plain or base64, as found in dumps of stored
+// objects where the field's raw bytes were serialized as a string.
+func SetFromManagedField(entry metav1.ManagedFieldsEntry) (*fieldpath.Set, error) {
+	if entry.FieldsType != "" && entry.FieldsType != "FieldsV1" {
+		return nil, fmt.Errorf("unsupported fieldsType %q for manager %q", entry.FieldsType, entry.Manager)
+	}
+	set := &fieldpath.Set{}
+	if entry.FieldsV1 == nil {
+		return set, nil
+	}
+	if err := set.FromJSON(bytes.NewReader(storedFieldsV1(entry.FieldsV1.Raw))); err != nil {
+		return nil, fmt.Errorf("failed to parse fieldsV1 for manager %q: %v", entry.Manager, err)
+	}
+	return set, nil
+}
+
+// storedFieldsV1 returns the JSON object encoded in raw when raw is a JSON
+// string holding it, plain or base64. Anything else is returned unchanged.
+func storedFieldsV1(raw []byte) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return raw
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		return []byte(s)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(s); err == nil && bytes.HasPrefix(bytes.TrimSpace(decoded), []byte("{")) {
+		return decoded
+	}
+	return raw
+}
+
+// managerSet returns the union of the fieldsets of every managed fields entry
+// recorded for manager.
+func managerSet(obj *unstructured.Unstructured, manager string) (*fieldpath.Set, error) {
+	var set *fieldpath.Set
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager {
+			continue
+		}
+		entrySet, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			set = entrySet
+		} else {
+			set = set.Union(entrySet)
+		}
+	}
+	if set == nil {
+		return nil, fmt.Errorf("manager %q not found in managedFields", manager)
+	}
+	return set, nil
+}
+
+// ExtractItemsWithKeys extracts the leaves of set from tv like
+// TypedValue.ExtractItems, but also keeps the key fields of every
+// associative-list element on the way to an extracted field. Without the
+// keys, an extracted list element cannot be merged back into another object
+// ("associative list with keys has an element that omits key field").
+// Fields of set missing from tv, e.g. below a spec the object no longer has,
+// are skipped rather than extracted as nulls.
+func ExtractItemsWithKeys(tv *typed.TypedValue, set *fieldpath.Set) *typed.TypedValue {
+	extracted, _, _ := extractPresent(tv, set)
+	return extracted
+}
+
+// extractPresent is ExtractItemsWithKeys, also returning the set it extracted,
+// list keys included, and the leaves of set that were skipped because tv
+// lacks them.
+func extractPresent(tv *typed.TypedValue, set *fieldpath.Set) (extracted *typed.TypedValue, used, missing *fieldpath.Set) {
+	obj := tv.AsValue().Unstructured()
+	present := fieldpath.NewSet()
+	missing = fieldpath.NewSet()
+	set.Leaves().Iterate(func(p fieldpath.Path) {
+		if v, ok := valueAtPath(obj, p); ok && v != nil {
+			present.Insert(p.Copy())
+		} else {
+			missing.Insert(p.Copy())
+		}
+	})
+	used = withListKeys(present)
+	return tv.ExtractItems(used), used, missing
+}
+
+// withListKeys returns a copy of set that additionally holds the key fields
+// of every associative-list element mentioned in set, at every level of
+// nesting.
+func withListKeys(set *fieldpath.Set) *fieldpath.Set {
+	out := set.Union(fieldpath.NewSet())
+	set.Iterate(func(p fieldpath.Path) {
+		for i, pe := range p {
+			if pe.Key == nil {
+				continue
+			}
+			for _, key := range *pe.Key {
+				name := key.Name
+				out.Insert(append(p[:i+1].Copy(), fieldpath.PathElement{FieldName: &name}))
+			}
+		}
+	})
+	return out
+}
+
+// typedExtraction is an object typed under the schema for its GVK, as the
+// extract functions take it.
+type typedExtraction struct {
+	tv  *typed.TypedValue
+	gvk schema.GroupVersionKind
+}
+
+// typedForExtraction types obj for the extract functions.
+func (r *Creator) typedForExtraction(ctx context.Context, obj *unstructured.Unstructured) (*typedExtraction, error) {
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	tv, err := r.typedObject(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	return &typedExtraction{tv: tv, gvk: gvk}, nil
+}
+
+// extract extracts the leaves of set from obj with the object's identity
+// fields and the list keys, as every extract function does, and also returns
+// the set it extracted. The steps are traced under manager, which is empty
+// for extractions not tied to one, and the leaves of set the object lacks are
+// logged.
+func (r *Creator) extract(ctx context.Context, obj *typedExtraction, manager string, set *fieldpath.Set) (*typed.TypedValue, *fieldpath.Set) {
+	r.trace(TraceEvent{Type: TraceExtractStart, GVK: obj.gvk, Manager: manager})
+	leaves := set.Leaves()
+	extracted, used, missing := extractPresent(obj.tv, leaves.Union(identityFields))
+	if r.tracer != nil {
+		r.trace(TraceEvent{Type: TraceSetParsed, GVK: obj.gvk, Manager: manager, Paths: FormatSet(leaves)})
+		used.Difference(leaves).Difference(identityFields).Iterate(func(p fieldpath.Path) {
+			r.trace(TraceEvent{Type: TraceKeyInjected, GVK: obj.gvk, Manager: manager, Path: FormatPath(p)})
+		})
+	}
+	if missing = missing.Difference(identityFields); !missing.Empty() {
+		r.logger(ctx).Info("Warning: managedFields reference fields missing from the object", "manager", manager, "fields", FormatSet(missing))
+	}
+	return extracted, used
+}
+
+// ExtractManager extracts the fields owned by manager from obj, together with
+// the object's identity fields and the keys of every associative-list element
+// the manager owns fields in. The result can be merged into, or applied over,
+// another version of the object. Owned fields the object lacks, such as a
+// spec removed while its managedFields remain, are logged and left out.
+func (r *Creator) ExtractManager(ctx context.Context, obj *unstructured.Unstructured, manager string) (*typed.TypedValue, error) {
+	extracted, _, err := r.ExtractManagerFull(ctx, obj, manager)
+	return extracted, err
+}
+
+// ExtractManagerFull extracts the fields owned by manager like ExtractManager
+// and also returns the fieldset it extracted: the manager's leaf fields
+// present in obj, the identity fields and the injected list keys. The set
+// lends itself to further ownership computations without recomputing it.
+func (r *Creator) ExtractManagerFull(ctx context.Context, obj *unstructured.Unstructured, manager string) (*typed.TypedValue, *fieldpath.Set, error) {
+	var cacheKey string
+	if r.extractCache != nil && obj != nil {
+		var err error
+		if cacheKey, err = extractCacheKey(obj, manager); err != nil {
+			return nil, nil, err
+		}
+		if extracted, used, ok := r.extractCache.get(cacheKey); ok {
+			return extracted, used, nil
+		}
+	}
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	set, err := managerSet(obj, manager)
+	if err != nil {
+		return nil, nil, err
+	}
+	extracted, used := r.extract(ctx, typedObj, manager, set)
+	if cacheKey != "" {
+		r.extractCache.add(cacheKey, extracted, used)
+	}
+	return extracted, used, nil
+}
+
+// ExtractManagerAtVersion extracts the fields owned by manager like
+// ExtractManager, but interprets obj and its managedFields under the schema of
+// apiVersion, e.g. "apps/v1", instead of the object's own version. The object
+// is not converted: its content must fit that schema. The result carries
+// apiVersion. It fails when the schema has no type for the object's kind in
+// apiVersion.
+func (r *Creator) ExtractManagerAtVersion(ctx context.Context, obj *unstructured.Unstructured, manager, apiVersion string) (*typed.TypedValue, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apiVersion %q: %v", apiVersion, err)
+	}
+	gvk := gv.WithKind(obj.GetKind())
+	if _, gvkToTypeNameMap := r.types(); gvkToTypeNameMap[gvk] == "" {
+		return nil, fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	pinned := obj.DeepCopy()
+	pinned.SetAPIVersion(apiVersion)
+	return r.ExtractManager(ctx, pinned, manager)
+}
+
+// UnresolvablePaths returns the FormatPath paths of the leaf fields owned by
+// manager that the schema of obj does not declare, sorted. Extraction drops
+// such fields silently; they typically remain in managedFields after a
+// field was removed from a type, e.g. across a CRD upgrade.
+func (r *Creator) UnresolvablePaths(ctx context.Context, obj *unstructured.Unstructured, manager string) ([]string, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	set, err := managerSet(obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	s, root, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, err
+	}
+	unresolvable := []string{}
+	set.Leaves().Iterate(func(p fieldpath.Path) {
+		if _, err := atomAtPath(s, root, p); err != nil {
+			unresolvable = append(unresolvable, FormatPath(p))
+		}
+	})
+	sort.Strings(unresolvable)
+	return unresolvable, nil
+}
+
+// ExtractManagerExcept extracts the fields owned by manager like
+// ExtractManager, leaving out every field at or below one of the except
+// paths, e.g. "status" to drop everything under status. The paths use the
+// ParsePath syntax. The object's identity fields are always kept.
+func (r *Creator) ExtractManagerExcept(ctx context.Context, obj *unstructured.Unstructured, manager string, except []string) (*typed.TypedValue, error) {
+	excluded, err := ParsePaths(except)
+	if err != nil {
+		return nil, err
+	}
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	set, err := managerSet(obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	kept := fieldpath.NewSet()
+	set.Leaves().Iterate(func(p fieldpath.Path) {
+		for i := 1; i <= len(p); i++ {
+			if excluded.Has(p[:i]) {
+				return
+			}
+		}
+		kept.Insert(p.Copy())
+	})
+	extracted, _ := r.extract(ctx, typedObj, manager, kept)
+	return extracted, nil
+}
+
+// ExtractManagers extracts the fields owned by any of managers from obj, like
+// ExtractManager applied to the union of their fieldsets. Fields shared by
+// several managers appear once.
+func (r *Creator) ExtractManagers(ctx context.Context, obj *unstructured.Unstructured, managers ...string) (*typed.TypedValue, error) {
+	if len(managers) == 0 {
+		return nil, fmt.Errorf("at least one manager is required")
+	}
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	combined := fieldpath.NewSet()
+	for _, manager := range managers {
+		set, err := managerSet(obj, manager)
+		if err != nil {
+			return nil, err
+		}
+		combined = combined.Union(set)
+	}
+	extracted, _ := r.extract(ctx, typedObj, strings.Join(managers, ","), combined)
+	return extracted, nil
+}
+
+// ExtractScalars returns the scalar fields owned by manager as a flat map
+// from their FormatPath path to their value, e.g.
+// `.spec.ports[port=80,protocol="TCP"].nodePort` to 30001. Unlike
+// ExtractManager, it adds neither identity fields nor list keys. Scalars
+// inside a map or list the manager owns as a whole are included.
+func (r *Creator) ExtractScalars(ctx context.Context, obj *unstructured.Unstructured, manager string) (map[string]interface{}, error) {
+	tv, err := r.typedObject(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	set, err := managerSet(obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	leaves := set.Leaves()
+	scalars := map[string]interface{}{}
+	err = WalkTyped(tv, func(p fieldpath.Path, v value.Value) error {
+		if v == nil || v.IsNull() || v.IsMap() || v.IsList() {
+			return nil
+		}
+		for i := 1; i <= len(p); i++ {
+			if leaves.Has(p[:i]) {
+				scalars[FormatPath(p)] = v.Unstructured()
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scalars, nil
+}
+
+// ExtractComplement extracts everything set in obj that manager does not own,
+// i.e. what the other managers and the apiserver contribute. Fields below a
+// map or list the manager owns as a whole count as owned. The result carries
+// the object's identity and list keys, like ExtractManager, but no
+// managedFields.
+func (r *Creator) ExtractComplement(ctx context.Context, obj *unstructured.Unstructured, manager string) (*typed.TypedValue, error) {
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	set, err := managerSet(obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	typedObj.tv = typedObj.tv.RemoveItems(fieldpath.NewSet(fieldpath.MakePathOrDie("metadata", "managedFields")))
+	populated, err := typedObj.tv.ToFieldSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute object field set: %v", err)
+	}
+	owned := set.Leaves()
+	complement := fieldpath.NewSet()
+	populated.Leaves().Iterate(func(p fieldpath.Path) {
+		for i := 1; i <= len(p); i++ {
+			if owned.Has(p[:i]) {
+				return
+			}
+		}
+		complement.Insert(p.Copy())
+	})
+	extracted, _ := r.extract(ctx, typedObj, "", complement)
+	return extracted, nil
+}
+
+// ExtractWithFields extracts the fields in fields from obj, like
+// ExtractManager but independent of the object's own managedFields. It is
+// meant for fieldsets stored apart from the object.
+func (r *Creator) ExtractWithFields(ctx context.Context, obj *unstructured.Unstructured, fields *metav1.FieldsV1) (*typed.TypedValue, error) {
+	if fields == nil {
+		return nil, fmt.Errorf("fields cannot be nil")
+	}
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	set, err := SetFromManagedField(metav1.ManagedFieldsEntry{FieldsType: "FieldsV1", FieldsV1: fields})
+	if err != nil {
+		return nil, err
+	}
+	extracted, _ := r.extract(ctx, typedObj, "", set)
+	return extracted, nil
+}
+
+// ExtractAsPatch returns the fields owned by manager as a JSON patch. Because
+// the patch carries the object's identity and the keys of every associative
+// list element, it merges correctly server-side when sent through the
+// dynamic client's Patch with types.StrategicMergePatchType (built-in kinds)
+// or types.ApplyPatchType. Nulls, left for maps the manager owns as a whole
+// but only granularly extracts, are pruned, as they would delete the live
+// fields.
+func (r *Creator) ExtractAsPatch(ctx context.Context, obj *unstructured.Unstructured, manager string) ([]byte, error) {
+	extracted, err := r.ExtractManager(ctx, obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	u, err := ToUnstructured(extracted)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(u.Object)
+	return json.Marshal(u.Object)
+}
+
+// ExtractYAML returns the fields owned by manager, with the object's identity
+// and list keys, as YAML for review. It holds the same content as
+// ExtractAsPatch, nulls pruned, converted from JSON. Map keys are sorted, so
+// the output is deterministic and diffs cleanly.
+func (r *Creator) ExtractYAML(ctx context.Context, obj *unstructured.Unstructured, manager string) ([]byte, error) {
+	extracted, err := r.ExtractManager(ctx, obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	u, err := ToUnstructured(extracted)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(u.Object)
+	return yaml.Marshal(u.Object)
+}
+
+// lastAppliedAnnotation is the annotation in which "kubectl apply" records
+// the configuration it last applied.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// BuildLastApplied returns the fields owned by manager, with the object's
+// identity and list keys, as the kubectl.kubernetes.io/last-applied-
+// configuration annotation holds them: compact JSON with sorted keys and a
+// trailing newline. Nulls, which kubectl would read as deletions, and the
+// annotation itself are left out. The
+// result can seed the annotation when moving a manager from server-side to
+// client-side apply.
+func (r *Creator) BuildLastApplied(ctx context.Context, obj *unstructured.Unstructured, manager string) ([]byte, error) {
+	extracted, err := r.ExtractManager(ctx, obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	u, err := ToUnstructured(extracted)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(u.Object)
+	unstructured.RemoveNestedField(u.Object, "metadata", "annotations", lastAppliedAnnotation)
+	b, err := json.Marshal(u.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize last applied configuration: %v", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// ExtractBySubresource extracts the fields owned by manager separately for
+// each subresource its managedFields entries were recorded against, e.g. the
+// main resource, "status" or "scale". The main resource is keyed by "".
+func (r *Creator) ExtractBySubresource(ctx context.Context, obj *unstructured.Unstructured, manager string) (map[string]*typed.TypedValue, error) {
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	sets := map[string]*fieldpath.Set{}
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager {
+			continue
+		}
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := sets[entry.Subresource]; ok {
+			set = existing.Union(set)
+		}
+		sets[entry.Subresource] = set
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("manager %q not found in managedFields", manager)
+	}
+
+	extracted := make(map[string]*typed.TypedValue, len(sets))
+	for subresource, set := range sets {
+		extracted[subresource], _ = r.extract(ctx, typedObj, manager, set)
+	}
+	return extracted, nil
+}
+
+// ExtractByOperation extracts, for every manager with managedFields entries
+// of operation op, the fields recorded by those entries, keyed by manager.
+// Fields a manager owns through Apply and through Update are thereby told
+// apart. Managers without entries of op are left out.
+func (r *Creator) ExtractByOperation(ctx context.Context, obj *unstructured.Unstructured, op metav1.ManagedFieldsOperationType) (map[string]*typed.TypedValue, error) {
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	sets := map[string]*fieldpath.Set{}
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Operation != op {
+			continue
+		}
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := sets[entry.Manager]; ok {
+			set = existing.Union(set)
+		}
+		sets[entry.Manager] = set
+	}
+
+	extracted := make(map[string]*typed.TypedValue, len(sets))
+	for manager, set := range sets {
+		extracted[manager], _ = r.extract(ctx, typedObj, manager, set)
+	}
+	return extracted, nil
+}
+
+// ExtractAllManagers extracts the fields owned by every manager in obj's
+// managedFields, keyed by manager, like ExtractByOperation without regard to
+// the operation. Managers are extracted one after the other unless
+// WithExtractConcurrency is set, in which case they are extracted in
+// parallel; the extractions only read the typed object and the schema, which
+// they share.
+func (r *Creator) ExtractAllManagers(ctx context.Context, obj *unstructured.Unstructured) (map[string]*typed.TypedValue, error) {
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := managerSets(obj)
+	if err != nil {
+		return nil, err
+	}
+	managers := make([]string, 0, len(sets))
+	for manager := range sets {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+
+	results := make([]*typed.TypedValue, len(managers))
+	extract := func(i int) {
+		results[i], _ = r.extract(ctx, typedObj, managers[i], sets[managers[i]])
+	}
+	if workers := r.extractWorkers; workers <= 1 {
+		for i := range managers {
+			extract(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < len(managers); i += workers {
+					extract(i)
+				}
+			}(w)
+		}
+		wg.Wait()
+	}
+
+	extracted := make(map[string]*typed.TypedValue, len(managers))
+	for i, manager := range managers {
+		extracted[manager] = results[i]
+	}
+	return extracted, nil
+}
+
+// ExtractFromList extracts the fields owned by manager from every item of
+// list, like ExtractManager, e.g. to audit the result of a LIST call. Each
+// item is resolved under its own GVK; items without apiVersion and kind are
+// taken to be of the list's kind without its "List" suffix. A failed item
+// does not stop the others: the results are indexed like the items, with nil
+// for the failed ones, and the failures are returned together as a
+// *BatchError.
+func (r *Creator) ExtractFromList(ctx context.Context, list *unstructured.UnstructuredList, manager string) ([]*typed.TypedValue, error) {
+	if list == nil {
+		return nil, fmt.Errorf("list cannot be nil")
+	}
+	results := make([]*typed.TypedValue, len(list.Items))
+	errs := make([]error, len(list.Items))
+	failed := false
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetAPIVersion() == "" && item.GetKind() == "" {
+			item = item.DeepCopy()
+			item.SetAPIVersion(list.GetAPIVersion())
+			item.SetKind(strings.TrimSuffix(list.GetKind(), "List"))
+		}
+		if results[i], errs[i] = r.ExtractManager(ctx, item, manager); errs[i] != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return results, &BatchError{Errors: errs}
+	}
+	return results, nil
+}
+
+// ExtractSinceAnnotation extracts the fields recorded by the managedFields
+// entries updated after the RFC 3339 time stored in obj's annotationKey
+// annotation, e.g. written by a controller at the end of its last reconcile,
+// whatever their manager. Entries without a time are left out. It fails when
+// the annotation is missing or not a valid time.
+func (r *Creator) ExtractSinceAnnotation(ctx context.Context, obj *unstructured.Unstructured, annotationKey string) (*typed.TypedValue, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	stored, ok := obj.GetAnnotations()[annotationKey]
+	if !ok {
+		return nil, fmt.Errorf("annotation %q not found", annotationKey)
+	}
+	since, err := time.Parse(time.RFC3339, stored)
+	if err != nil {
+		return nil, fmt.Errorf("annotation %q does not hold an RFC 3339 time: %v", annotationKey, err)
+	}
+	return r.extractModifiedSince(ctx, obj, since)
+}
+
+// extractModifiedSince extracts the fields recorded by the managedFields
+// entries of obj whose time is after since.
+func (r *Creator) extractModifiedSince(ctx context.Context, obj *unstructured.Unstructured, since time.Time) (*typed.TypedValue, error) {
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	set := fieldpath.NewSet()
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Time == nil || !entry.Time.After(since) {
+			continue
+		}
+		entrySet, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		set = set.Union(entrySet)
+	}
+	extracted, _ := r.extract(ctx, typedObj, "", set)
+	return extracted, nil
+}
+
+// LatestManagerExtract extracts the fields recorded by the managedFields entry
+// with the most recent time, answering what the last writer touched, and
+// returns them with that entry's manager. Entries without a time count as the
+// oldest; of entries with equal times the first wins.
+func (r *Creator) LatestManagerExtract(ctx context.Context, obj *unstructured.Unstructured) (*typed.TypedValue, string, error) {
+	typedObj, err := r.typedForExtraction(ctx, obj)
+	if err != nil {
+		return nil, "", err
+	}
+	entries := obj.GetManagedFields()
+	if len(entries) == 0 {
+		return nil, "", fmt.Errorf("object has no managedFields")
+	}
+	latest := entries[0]
+	for _, entry := range entries[1:] {
+		if entry.Time != nil && (latest.Time == nil || entry.Time.After(latest.Time.Time)) {
+			latest = entry
+		}
+	}
+	set, err := SetFromManagedField(latest)
+	if err != nil {
+		return nil, "", err
+	}
+	extracted, _ := r.extract(ctx, typedObj, latest.Manager, set)
+	return extracted, latest.Manager, nil
+}
+
+// AssembleSubresources merges the parts returned by ExtractBySubresource back
+// into a single object of type gvk, reversing the split. Parts are merged
+// main resource first, then by subresource name; their fields are already
+// relative to the object, so status fields stay under status.
+func (r *Creator) AssembleSubresources(ctx context.Context, parts map[string]*typed.TypedValue, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no parts to assemble")
+	}
+	objectType := r.ParseableType(ctx, gvk)
+	if objectType == nil {
+		return nil, fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	subresources := make([]string, 0, len(parts))
+	for subresource := range parts {
+		subresources = append(subresources, subresource)
+	}
+	sort.Strings(subresources)
+
+	var assembled *typed.TypedValue
+	for _, subresource := range subresources {
+		if parts[subresource] == nil {
+			return nil, fmt.Errorf("part %q is nil", subresource)
+		}
+		part, err := objectType.FromUnstructured(parts[subresource].AsValue().Unstructured())
+		if err != nil {
+			return nil, fmt.Errorf("part %q is not a valid %v: %v", subresource, gvk, err)
+		}
+		if assembled == nil {
+			assembled = part
+			continue
+		}
+		if assembled, err = assembled.Merge(part); err != nil {
+			return nil, fmt.Errorf("failed to merge part %q: %v", subresource, err)
+		}
+	}
+	result, err := ToUnstructured(assembled)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(result.Object)
+	return result, nil
+}
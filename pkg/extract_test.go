@@ -0,0 +1,737 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+func TestExtractManagerMerges(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, err := r.ExtractManager(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+
+	// Same merge as TestIssue, which fails when the list keys are missing.
+	newObj, err := r.ParseableType(ctx, serviceGVK).FromUnstructured(jsonToInterface(`{"metadata":{"annotations":null},"spec":{"externalTrafficPolicy":"Cluster","internalTrafficPolicy":"Cluster","ports":[{"name":"http","port":80,"protocol":"TCP","targetPort":80}],"selector":{"app":"clear-nginx"},"sessionAffinity":"None","type":"NodePort"}}`))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+	merged, err := newObj.Merge(extracted)
+	if err != nil {
+		t.Fatalf("failed to merge objects: %v", err)
+	}
+	u, err := ToUnstructured(merged)
+	if err != nil {
+		t.Fatalf("failed to convert merged object: %v", err)
+	}
+	ports := u.Object["spec"].(map[string]interface{})["ports"].([]interface{})
+	if len(ports) != 1 || ports[0].(map[string]interface{})["nodePort"] == nil {
+		t.Errorf("expected nodePort to be merged into the existing port, got %v", ports)
+	}
+}
+
+func TestExtractAsPatch(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	patch, err := r.ExtractAsPatch(context.Background(), object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract patch: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(patch, &got); err != nil {
+		t.Fatalf("patch is not valid JSON: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected patch:\n got: %s\nwant: %s", JsonObjectToString(got), JsonObjectToString(want))
+	}
+
+	if _, err := r.ExtractAsPatch(context.Background(), object, "missing"); err == nil {
+		t.Error("expected an error for an unknown manager")
+	}
+}
+
+// labelOwnerJSON is a Service whose labels map is owned as a leaf, which
+// extractions of the granular map leave as null.
+const labelOwnerJSON = `{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","labels":{"app":"web"},"managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:metadata":{"f:labels":{}},"f:spec":{"f:type":{}}},"manager":"labeler","operation":"Update"}]},"spec":{"type":"ClusterIP"}}`
+
+func TestExtractAsPatchPrunesNulls(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(labelOwnerJSON)
+
+	patch, err := r.ExtractAsPatch(context.Background(), object, "labeler")
+	if err != nil {
+		t.Fatalf("failed to extract patch: %v", err)
+	}
+	if want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"ClusterIP"}}`; string(patch) != want {
+		t.Errorf("expected %v, got %s", want, patch)
+	}
+}
+
+func TestExtractBySubresource(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"lb","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:type":{}}},"manager":"lb-controller","operation":"Update"},{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:status":{"f:loadBalancer":{"f:ingress":{}}}},"manager":"lb-controller","operation":"Update","subresource":"status"}]},"spec":{"type":"LoadBalancer","selector":{"app":"lb"}},"status":{"loadBalancer":{"ingress":[{"ip":"10.0.0.1"}]}}}`)
+
+	parts, err := r.ExtractBySubresource(context.Background(), object, "lb-controller")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := map[string]interface{}{
+		"":       jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"lb"},"spec":{"type":"LoadBalancer"}}`),
+		"status": jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"lb"},"status":{"loadBalancer":{"ingress":[{"ip":"10.0.0.1"}]}}}`),
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("expected %d subresources, got %d", len(want), len(parts))
+	}
+	for subresource, w := range want {
+		part, ok := parts[subresource]
+		if !ok {
+			t.Errorf("missing subresource %q", subresource)
+			continue
+		}
+		if got := part.AsValue().Unstructured(); !reflect.DeepEqual(got, w) {
+			t.Errorf("subresource %q:\n got: %v\nwant: %v", subresource, got, w)
+		}
+	}
+}
+
+func TestExtractWithFields(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	fields := object.GetManagedFields()[1].FieldsV1
+	object.SetManagedFields(nil)
+
+	extracted, err := r.ExtractWithFields(context.Background(), object, fields)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`)
+	if got := extracted.AsValue().Unstructured(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected extraction:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestExtractYAML(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	got, err := r.ExtractYAML(context.Background(), object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract YAML: %v", err)
+	}
+	want := `apiVersion: v1
+kind: Service
+metadata:
+  name: clear-nginx-service
+spec:
+  ports:
+  - nodePort: 30001
+    port: 80
+    protocol: TCP
+`
+	if string(got) != want {
+		t.Errorf("unexpected YAML:\n got: %s\nwant: %s", got, want)
+	}
+
+	got, err = r.ExtractYAML(context.Background(), jsonToUnstructured(labelOwnerJSON), "labeler")
+	if err != nil {
+		t.Fatalf("failed to extract YAML: %v", err)
+	}
+	want = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: ClusterIP
+`
+	if string(got) != want {
+		t.Errorf("expected nulls to be pruned:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestExtractManagers(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, err := r.ExtractManagers(context.Background(), object, "kubectl-client-side-apply", "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	u, err := ToUnstructured(extracted)
+	if err != nil {
+		t.Fatalf("failed to convert extracted object: %v", err)
+	}
+	spec := u.Object["spec"].(map[string]interface{})
+	want := jsonToInterface(`{"ports":[{"name":"http","nodePort":30001,"port":80,"protocol":"TCP","targetPort":80}]}`)
+	if JsonObjectToString(spec["ports"]) != JsonObjectToString(want["ports"]) {
+		t.Errorf("expected both managers' port fields in a single element, got %v", spec["ports"])
+	}
+	if spec["type"] != "NodePort" {
+		t.Errorf("expected spec.type from kubectl-client-side-apply, got %v", spec["type"])
+	}
+
+	if _, err := r.ExtractManagers(context.Background(), object); err == nil {
+		t.Error("expected an error without managers")
+	}
+}
+
+func TestExtractManagerExcept(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, err := r.ExtractManagerExcept(context.Background(), object, "kubectl-client-side-apply", []string{
+		"metadata",
+		`spec.ports[port=80,protocol="TCP"].targetPort`,
+		"spec.selector",
+	})
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"externalTrafficPolicy":"Cluster","internalTrafficPolicy":"Cluster","ports":[{"name":"http","port":80,"protocol":"TCP"}],"sessionAffinity":"None","type":"NodePort"}}`)
+	if got := extracted.AsValue().Unstructured(); JsonObjectToString(got) != JsonObjectToString(want) {
+		t.Errorf("unexpected extraction:\n got: %v\nwant: %v", JsonObjectToString(got), JsonObjectToString(want))
+	}
+
+	if _, err := r.ExtractManagerExcept(context.Background(), object, "kubectl-edit", []string{"spec.ports[port="}); err == nil {
+		t.Error("expected an error for a malformed path")
+	}
+}
+
+func TestExtractScalars(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	scalars, err := r.ExtractScalars(context.Background(), object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract scalars: %v", err)
+	}
+	if len(scalars) != 1 || fmt.Sprint(scalars[`.spec.ports[port=80,protocol="TCP"].nodePort`]) != "30001" {
+		t.Errorf("expected only the nodePort, got %v", scalars)
+	}
+
+	scalars, err = r.ExtractScalars(context.Background(), object, "kubectl-client-side-apply")
+	if err != nil {
+		t.Fatalf("failed to extract scalars: %v", err)
+	}
+	if scalars[".spec.type"] != "NodePort" {
+		t.Errorf("expected spec.type, got %v", scalars)
+	}
+	if _, ok := scalars[`.spec.ports[port=80,protocol="TCP"].nodePort`]; ok {
+		t.Error("expected nodePort not to be owned by kubectl-client-side-apply")
+	}
+}
+
+func TestExtractComplement(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	complement, err := r.ExtractComplement(context.Background(), object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract complement: %v", err)
+	}
+	u, err := ToUnstructured(complement)
+	if err != nil {
+		t.Fatalf("failed to convert complement: %v", err)
+	}
+	spec := u.Object["spec"].(map[string]interface{})
+	if spec["type"] != "NodePort" || !reflect.DeepEqual(spec["selector"], map[string]interface{}{"app": "clear-nginx"}) {
+		t.Errorf("expected type and selector in the complement, got %v", spec)
+	}
+	port := spec["ports"].([]interface{})[0].(map[string]interface{})
+	if _, ok := port["nodePort"]; ok {
+		t.Errorf("expected nodePort, owned by kubectl-edit, to be left out, got %v", port)
+	}
+	if _, ok := u.Object["metadata"].(map[string]interface{})["managedFields"]; ok {
+		t.Error("expected no managedFields in the complement")
+	}
+
+	if _, err := r.ExtractComplement(context.Background(), nil, "kubectl-edit"); err == nil {
+		t.Error("expected an error for a nil object")
+	}
+}
+
+func TestExtractManagerMissingSpec(t *testing.T) {
+	r := newTestCreator(t)
+	for _, spec := range []string{``, `"spec":null,`} {
+		object := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service",` + spec + `"metadata":{"name":"gone","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:ports":{"k:{\"port\":80,\"protocol\":\"TCP\"}":{"f:nodePort":{}}},"f:type":{}}},"manager":"kubectl-edit","operation":"Update"}]}}`)
+
+		extracted, err := r.ExtractManager(context.Background(), object, "kubectl-edit")
+		if err != nil {
+			t.Fatalf("failed to extract: %v", err)
+		}
+		want := jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"gone"}}`)
+		if got := extracted.AsValue().Unstructured(); !reflect.DeepEqual(got, want) {
+			t.Errorf("object with %q: expected only the identity fields, got %v", spec, got)
+		}
+	}
+}
+
+func TestExtractPreservesIntegers(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, err := r.ExtractManager(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	base := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"name":"http","port":80,"protocol":"TCP"}]}}`)
+	overlay, err := ToUnstructured(extracted)
+	if err != nil {
+		t.Fatalf("failed to convert extracted object: %v", err)
+	}
+	merged, err := r.MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	port := merged.Object["spec"].(map[string]interface{})["ports"].([]interface{})[0].(map[string]interface{})
+	for _, field := range []string{"port", "nodePort"} {
+		if _, ok := port[field].(int64); !ok {
+			t.Errorf("expected %v to be an int64, got %T %v", field, port[field], port[field])
+		}
+	}
+	if got := JsonObjectToString(port); got != `{"name":"http","nodePort":30001,"port":80,"protocol":"TCP"}` {
+		t.Errorf("unexpected port: %v", got)
+	}
+}
+
+func TestExtractByOperation(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	updates, err := r.ExtractByOperation(ctx, object, metav1.ManagedFieldsOperationUpdate)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if len(updates) != 2 || updates["kubectl-client-side-apply"] == nil || updates["kubectl-edit"] == nil {
+		t.Fatalf("expected both Update managers, got %v", updates)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(updates["kubectl-edit"].AsValue().Unstructured()); got != want {
+		t.Errorf("unexpected kubectl-edit extraction:\n got: %v\nwant: %v", got, want)
+	}
+
+	applies, err := r.ExtractByOperation(ctx, object, metav1.ManagedFieldsOperationApply)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if len(applies) != 0 {
+		t.Errorf("expected no Apply managers, got %v", applies)
+	}
+}
+
+func TestExtractManagerNestedListKeys(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	pod := jsonToUnstructured(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:containers":{"k:{\"name\":\"app\"}":{"f:ports":{"k:{\"containerPort\":80,\"protocol\":\"TCP\"}":{"f:name":{}}}}}}},"manager":"port-namer","operation":"Update"}]},"spec":{"containers":[{"name":"sidecar","image":"envoy"},{"name":"app","image":"nginx","ports":[{"containerPort":443,"protocol":"TCP"},{"containerPort":80,"protocol":"TCP","name":"http"}]}]}}`)
+
+	extracted, err := r.ExtractManager(ctx, pod, "port-namer")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"},"spec":{"containers":[{"name":"app","ports":[{"containerPort":80,"name":"http","protocol":"TCP"}]}]}}`
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("unexpected extraction:\n got: %v\nwant: %v", got, want)
+	}
+
+	fragment, err := ToUnstructured(extracted)
+	if err != nil {
+		t.Fatalf("failed to convert extraction: %v", err)
+	}
+	base := jsonToUnstructured(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"},"spec":{"containers":[{"name":"sidecar","image":"envoy"},{"name":"app","image":"nginx","ports":[{"containerPort":443,"protocol":"TCP"},{"containerPort":80,"protocol":"TCP"}]}]}}`)
+	merged, err := r.MergeObjects(ctx, base, fragment)
+	if err != nil {
+		t.Fatalf("failed to merge nested fragment: %v", err)
+	}
+	want = `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"},"spec":{"containers":[{"image":"envoy","name":"sidecar"},{"image":"nginx","name":"app","ports":[{"containerPort":443,"protocol":"TCP"},{"containerPort":80,"name":"http","protocol":"TCP"}]}]}}`
+	if got := JsonObjectToString(merged.Object); got != want {
+		t.Errorf("unexpected merge result:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestExtractFromList(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	bare := jsonToUnstructured(issueServiceJSON)
+	delete(bare.Object, "apiVersion")
+	delete(bare.Object, "kind")
+	unknown := jsonToUnstructured(issueServiceJSON)
+	unknown.SetAPIVersion("example.com/v1")
+	unknown.SetKind("Gadget")
+	list := &unstructured.UnstructuredList{
+		Object: map[string]interface{}{"apiVersion": "v1", "kind": "ServiceList"},
+		Items:  []unstructured.Unstructured{*jsonToUnstructured(issueServiceJSON), *unknown, *bare},
+	}
+
+	extracted, err := r.ExtractFromList(ctx, list, "kubectl-edit")
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a *BatchError, got %v", err)
+	}
+	if batchErr.Errors[0] != nil || batchErr.Errors[1] == nil || batchErr.Errors[2] != nil {
+		t.Errorf("expected only the unknown item to fail, got %v", batchErr.Errors)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`
+	for _, i := range []int{0, 2} {
+		if extracted[i] == nil {
+			t.Errorf("item %d: expected an extraction", i)
+		} else if got := JsonObjectToString(extracted[i].AsValue().Unstructured()); got != want {
+			t.Errorf("item %d: unexpected extraction:\n got: %v\nwant: %v", i, got, want)
+		}
+	}
+	if extracted[1] != nil {
+		t.Errorf("expected no extraction for the failed item, got %v", extracted[1])
+	}
+	if list.Items[2].GetKind() != "" {
+		t.Error("the list must not be modified")
+	}
+}
+
+func TestExtractSinceAnnotation(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	const annotation = "example.com/last-reconciled"
+	object := jsonToUnstructured(issueServiceJSON)
+
+	object.SetAnnotations(map[string]string{annotation: "2023-12-21T05:30:00Z"})
+	extracted, err := r.ExtractSinceAnnotation(ctx, object, annotation)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("unexpected extraction:\n got: %v\nwant: %v", got, want)
+	}
+
+	object.SetAnnotations(map[string]string{annotation: "2023-12-21T06:00:00Z"})
+	if extracted, err = r.ExtractSinceAnnotation(ctx, object, annotation); err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want = `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"}}`
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("expected only identity fields after the last update, got %v", got)
+	}
+
+	object.SetAnnotations(map[string]string{annotation: "2841"})
+	if _, err := r.ExtractSinceAnnotation(ctx, object, annotation); err == nil {
+		t.Error("expected an error for an unparseable annotation")
+	}
+	object.SetAnnotations(nil)
+	if _, err := r.ExtractSinceAnnotation(ctx, object, annotation); err == nil {
+		t.Error("expected an error for a missing annotation")
+	}
+}
+
+func TestBuildLastApplied(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	// Whether spec.selector is an atomic map depends on the cluster version,
+	// which decides how much of it a leaf in managedFields extracts.
+	unstructured.RemoveNestedField(object.Object, "spec", "selector")
+
+	lastApplied, err := r.BuildLastApplied(ctx, object, "kubectl-client-side-apply")
+	if err != nil {
+		t.Fatalf("failed to build last applied configuration: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"externalTrafficPolicy":"Cluster","internalTrafficPolicy":"Cluster","ports":[{"name":"http","port":80,"protocol":"TCP","targetPort":80}],"sessionAffinity":"None","type":"NodePort"}}` + "\n"
+	if string(lastApplied) != want {
+		t.Errorf("unexpected last applied configuration:\n got: %s\nwant: %s", lastApplied, want)
+	}
+
+	// With the annotation in place, the manager owns it again; like kubectl,
+	// the annotation leaves an empty annotations map behind.
+	object.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": string(lastApplied)})
+	if lastApplied, err = r.BuildLastApplied(ctx, object, "kubectl-client-side-apply"); err != nil {
+		t.Fatalf("failed to build last applied configuration: %v", err)
+	}
+	want = strings.Replace(want, `"metadata":{`, `"metadata":{"annotations":{},`, 1)
+	if string(lastApplied) != want {
+		t.Errorf("unexpected round-tripped configuration:\n got: %s\nwant: %s", lastApplied, want)
+	}
+}
+
+func TestLatestManagerExtract(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, manager, err := r.LatestManagerExtract(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if manager != "kubectl-edit" {
+		t.Errorf("expected kubectl-edit to be the latest manager, got %v", manager)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("unexpected extraction:\n got: %v\nwant: %v", got, want)
+	}
+
+	entries := object.GetManagedFields()
+	entries[1].Time = nil
+	object.SetManagedFields(entries)
+	if _, manager, err = r.LatestManagerExtract(ctx, object); err != nil || manager != entries[0].Manager {
+		t.Errorf("expected entries without a time to be the oldest, got %v, %v", manager, err)
+	}
+
+	object.SetManagedFields(nil)
+	if _, _, err := r.LatestManagerExtract(ctx, object); err == nil {
+		t.Error("expected an error for an object without managedFields")
+	}
+	if _, _, err := r.LatestManagerExtract(ctx, nil); err == nil {
+		t.Error("expected an error for a nil object")
+	}
+}
+
+func TestSetFromManagedFieldStoredFormat(t *testing.T) {
+	fields := `{"f:spec":{"f:ports":{"k:{\"port\":80,\"protocol\":\"TCP\"}":{"f:nodePort":{}}}}}`
+	want, err := SetFromManagedField(metav1.ManagedFieldsEntry{FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)}})
+	if err != nil {
+		t.Fatalf("failed to parse fieldsV1: %v", err)
+	}
+
+	quoted, _ := json.Marshal(fields)
+	encoded, _ := json.Marshal(base64.StdEncoding.EncodeToString([]byte(fields)))
+	object := jsonToUnstructured(fmt.Sprintf(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"stored","managedFields":[{"manager":"quoted","operation":"Update","fieldsV1":%s},{"manager":"encoded","operation":"Update","fieldsV1":%s}]}}`, quoted, encoded))
+	for _, entry := range object.GetManagedFields() {
+		got, err := SetFromManagedField(entry)
+		if err != nil {
+			t.Errorf("%v: failed to parse stored fieldsV1: %v", entry.Manager, err)
+			continue
+		}
+		if !got.Equals(want) {
+			t.Errorf("%v: expected %v, got %v", entry.Manager, want, got)
+		}
+	}
+}
+
+func TestExtractManagerAtVersion(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	pinned, err := r.ExtractManagerAtVersion(ctx, object, "kubectl-edit", "v1")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	extracted, err := r.ExtractManager(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if got, want := JsonObjectToString(pinned.AsValue().Unstructured()), JsonObjectToString(extracted.AsValue().Unstructured()); got != want {
+		t.Errorf("expected the same extraction as the object's own version:\n got: %v\nwant: %v", got, want)
+	}
+
+	for _, apiVersion := range []string{"v2", "apps/v1", "a/b/c"} {
+		if _, err := r.ExtractManagerAtVersion(ctx, object, "kubectl-edit", apiVersion); err == nil {
+			t.Errorf("%v: expected an error for a version without a Service schema", apiVersion)
+		}
+	}
+}
+
+func TestExtractManagerFull(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, set, err := r.ExtractManagerFull(context.Background(), object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	populated, err := extracted.ToFieldSet()
+	if err != nil {
+		t.Fatalf("failed to compute extracted field set: %v", err)
+	}
+	if !set.Leaves().Equals(populated.Leaves()) {
+		t.Errorf("expected the returned set to match the extracted fields:\n set: %v\nvalue: %v", FormatSet(set.Leaves()), FormatSet(populated.Leaves()))
+	}
+	for _, p := range []fieldpath.Path{
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "port"),
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "protocol"),
+	} {
+		if !set.Has(p) {
+			t.Errorf("expected the injected key %v in the set", FormatPath(p))
+		}
+	}
+}
+
+func TestWithExtractCache(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t, WithExtractCache(1))
+	object := jsonToUnstructured(issueServiceJSON)
+
+	first, err := r.ExtractManager(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := JsonObjectToString(first.AsValue().Unstructured())
+	// Callers own the values they receive.
+	delete(first.AsValue().Unstructured().(map[string]interface{}), "spec")
+
+	second, err := r.ExtractManager(ctx, object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if got := JsonObjectToString(second.AsValue().Unstructured()); got != want {
+		t.Errorf("expected the cached extraction to be unaffected by callers:\n got: %v\nwant: %v", got, want)
+	}
+	if len(r.extractCache.entries) != 1 {
+		t.Errorf("expected one cached extraction, got %d", len(r.extractCache.entries))
+	}
+
+	object.SetResourceVersion("2")
+	if _, err := r.ExtractManager(ctx, object, "kubectl-edit"); err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if len(r.extractCache.entries) != 1 {
+		t.Errorf("expected the cache to stay bounded, got %d entries", len(r.extractCache.entries))
+	}
+}
+
+func BenchmarkExtractManager(b *testing.B) {
+	object := jsonToUnstructured(issueServiceJSON)
+	for name, opts := range map[string][]Option{
+		"uncached": nil,
+		"cached":   {WithExtractCache(16)},
+	} {
+		b.Run(name, func(b *testing.B) {
+			r, err := New(context.Background(), cfg, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.ExtractManager(context.Background(), object, "kubectl-edit"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnresolvablePaths(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:type":{},"f:retiredField":{},"f:ports":{"k:{\"port\":80,\"protocol\":\"TCP\"}":{"f:legacyName":{},"f:port":{}}}}},"manager":"old-controller","operation":"Update"}]},"spec":{"type":"ClusterIP","ports":[{"port":80,"protocol":"TCP"}]}}`)
+
+	paths, err := r.UnresolvablePaths(context.Background(), object, "old-controller")
+	if err != nil {
+		t.Fatalf("failed to find unresolvable paths: %v", err)
+	}
+	want := []string{`.spec.ports[port=80,protocol="TCP"].legacyName`, ".spec.retiredField"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected %v, got %v", want, paths)
+	}
+}
+
+func TestAssembleSubresources(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"lb","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:type":{}}},"manager":"lb-controller","operation":"Update"},{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:status":{"f:loadBalancer":{"f:ingress":{}}}},"manager":"lb-controller","operation":"Update","subresource":"status"}]},"spec":{"type":"LoadBalancer"},"status":{"loadBalancer":{"ingress":[{"ip":"10.0.0.1"}]}}}`)
+
+	parts, err := r.ExtractBySubresource(ctx, object, "lb-controller")
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	assembled, err := r.AssembleSubresources(ctx, parts, serviceGVK)
+	if err != nil {
+		t.Fatalf("failed to assemble: %v", err)
+	}
+	if got, want := JsonObjectToString(assembled.Object), JsonObjectToString(withoutManagedFields(object).Object); got != want {
+		t.Errorf("expected the original object back:\n got: %v\nwant: %v", got, want)
+	}
+
+	if _, err := r.AssembleSubresources(ctx, nil, serviceGVK); err == nil {
+		t.Error("expected an error without parts")
+	}
+}
+
+func TestExtractAllManagers(t *testing.T) {
+	ctx := context.Background()
+	object := manyManagersService(20)
+	serial, err := newTestCreator(t).ExtractAllManagers(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	if len(serial) != 20 {
+		t.Fatalf("expected 20 managers, got %d", len(serial))
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"many-managers"},"spec":{"ports":[{"nodePort":30007,"port":8007,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(serial["controller-7"].AsValue().Unstructured()); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	parallel, err := newTestCreator(t, WithExtractConcurrency(4)).ExtractAllManagers(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	for manager, extracted := range serial {
+		got, ok := parallel[manager]
+		if !ok || JsonObjectToString(got.AsValue().Unstructured()) != JsonObjectToString(extracted.AsValue().Unstructured()) {
+			t.Errorf("%v: expected the parallel extraction to match the serial one", manager)
+		}
+	}
+}
+
+// manyManagersService returns a Service with n ports, each of whose
+// nodePort is owned by a different manager.
+func manyManagersService(n int) *unstructured.Unstructured {
+	var ports []interface{}
+	var managedFields []metav1.ManagedFieldsEntry
+	for i := 0; i < n; i++ {
+		ports = append(ports, map[string]interface{}{"port": int64(8000 + i), "protocol": "TCP", "nodePort": int64(30000 + i)})
+		managedFields = append(managedFields, metav1.ManagedFieldsEntry{
+			Manager:    fmt.Sprintf("controller-%d", i),
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: "v1",
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(fmt.Sprintf(`{"f:spec":{"f:ports":{"k:{\"port\":%d,\"protocol\":\"TCP\"}":{"f:nodePort":{}}}}}`, 8000+i))},
+		})
+	}
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "many-managers"},
+		"spec":       map[string]interface{}{"type": "NodePort", "ports": ports},
+	}}
+	object.SetManagedFields(managedFields)
+	return object
+}
+
+func BenchmarkExtractAllManagers(b *testing.B) {
+	object := manyManagersService(20)
+	for name, workers := range map[string]int{
+		"serial":   1,
+		"parallel": 4,
+	} {
+		b.Run(name, func(b *testing.B) {
+			r, err := New(context.Background(), cfg, WithExtractConcurrency(workers))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.ExtractAllManagers(context.Background(), object); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
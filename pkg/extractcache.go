@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// extractCache is a bounded LRU cache of ExtractManager results, keyed by
+// object content, resourceVersion and manager. See WithExtractCache.
+type extractCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *extractCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type extractCacheEntry struct {
+	key       string
+	extracted *typed.TypedValue
+	set       *fieldpath.Set
+}
+
+func newExtractCache(size int) *extractCache {
+	return &extractCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// extractCacheKey returns the cache key of the extraction of manager's fields
+// from obj.
+func extractCacheKey(obj *unstructured.Unstructured, manager string) (string, error) {
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash object: %v", err)
+	}
+	return fmt.Sprintf("%s/%x/%s", obj.GetResourceVersion(), sha256.Sum256(b), manager), nil
+}
+
+// get returns a copy of the extraction cached under key.
+func (c *extractCache) get(key string) (*typed.TypedValue, *fieldpath.Set, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	c.order.MoveToFront(elem)
+	entry := elem.Value.(*extractCacheEntry)
+	return cloneTyped(entry.extracted), entry.set.Union(fieldpath.NewSet()), true
+}
+
+// add caches a copy of an extraction under key, evicting the least recently
+// used entry when the cache is full.
+func (c *extractCache) add(key string, extracted *typed.TypedValue, set *fieldpath.Set) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&extractCacheEntry{
+		key:       key,
+		extracted: cloneTyped(extracted),
+		set:       set.Union(fieldpath.NewSet()),
+	})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*extractCacheEntry).key)
+	}
+}
+
+// purge drops every cached extraction, e.g. when the schema changes. It does
+// nothing on a nil cache, as when WithExtractCache is unset.
+func (c *extractCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// cloneTyped returns a deep copy of tv, which must hold JSON-compatible
+// values.
+func cloneTyped(tv *typed.TypedValue) *typed.TypedValue {
+	v := runtime.DeepCopyJSONValue(tv.AsValue().Unstructured())
+	return typed.AsTypedUnvalidated(value.NewValueInterface(v), tv.Schema(), tv.TypeRef())
+}
@@ -0,0 +1,37 @@
+// Package fake provides a fake TypeResolver for testing code that depends on
+// the utils package without building a Creator.
+package fake
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utils "my.domain/guestbook/pkg"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+// TypeResolver resolves GVKs from a fixed map.
+type TypeResolver struct {
+	// Types maps the GVKs the resolver knows to their types.
+	Types map[schema.GroupVersionKind]*typed.ParseableType
+	// Fallback is returned for GVKs missing from Types. When nil, such GVKs
+	// resolve to nil, like a Creator without WithDeducedFallback.
+	Fallback *typed.ParseableType
+}
+
+var _ utils.TypeResolver = &TypeResolver{}
+
+// NewDeducedTypeResolver returns a TypeResolver that resolves every GVK to
+// the deduced type, which merges maps granularly and lists atomically.
+func NewDeducedTypeResolver() *TypeResolver {
+	deduced := typed.DeducedParseableType
+	return &TypeResolver{Fallback: &deduced}
+}
+
+// ParseableType returns the type of gvk in Types, or Fallback.
+func (f *TypeResolver) ParseableType(_ context.Context, gvk schema.GroupVersionKind) *typed.ParseableType {
+	if t, ok := f.Types[gvk]; ok {
+		return t
+	}
+	return f.Fallback
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewFromKubectlCache builds a Creator offline from the OpenAPI v2 document
+// kubectl cached for the apiserver at host, e.g. "https://10.0.0.1:6443".
+// cacheDir is kubectl's cache directory, usually ~/.kube/cache; kubectl keeps
+// the document among its HTTP responses in the "http" subdirectory. Any
+// kubectl command that needs the schema, such as "kubectl explain", fills the
+// cache.
+func NewFromKubectlCache(ctx context.Context, cacheDir string, host string, opts ...Option) (*Creator, error) {
+	return NewFromModelSource(ctx, kubectlCacheSource{cacheDir: cacheDir, host: host}, opts...)
+}
+
+// kubectlCacheSource reads the OpenAPI document from kubectl's HTTP cache.
+type kubectlCacheSource struct {
+	cacheDir string
+	host     string
+}
+
+func (s kubectlCacheSource) OpenAPISchema() (*openapi_v2.Document, error) {
+	host := strings.TrimSuffix(s.host, "/")
+	// The discovery client sends its default timeout along with requests,
+	// which makes it part of the cache key.
+	for _, url := range []string{host + "/openapi/v2?timeout=32s", host + "/openapi/v2"} {
+		response, err := readKubectlCacheEntry(filepath.Join(s.cacheDir, "http"), url)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("kubectl cache entry for %v: %v", url, err)
+		}
+		return parseCachedOpenAPI(response)
+	}
+	return nil, fmt.Errorf("no cached OpenAPI schema for %v in %v; run a kubectl command such as 'kubectl explain pods' against the cluster to populate it", host, s.cacheDir)
+}
+
+// readKubectlCacheEntry returns the HTTP response cached for url. Entries are
+// named after the SHA256 sum of the URL and hold the SHA256 sum of the
+// response followed by the response itself.
+func readKubectlCacheEntry(dir, url string) (*http.Response, error) {
+	b, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(url)))))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < sha256.Size {
+		return nil, fmt.Errorf("entry is truncated")
+	}
+	dump, sum := b[sha256.Size:], sha256.Sum256(b[sha256.Size:])
+	if !bytes.Equal(b[:sha256.Size], sum[:]) {
+		return nil, fmt.Errorf("entry is stale or corrupt: checksum mismatch")
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), nil)
+}
+
+// parseCachedOpenAPI decodes a cached /openapi/v2 response, which holds the
+// document either as protobuf or as JSON.
+func parseCachedOpenAPI(response *http.Response) (*openapi_v2.Document, error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cached OpenAPI response has status %v", response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached OpenAPI response: %v", err)
+	}
+	if strings.Contains(response.Header.Get("Content-Type"), "json") {
+		return openapi_v2.ParseDocument(body)
+	}
+	doc := &openapi_v2.Document{}
+	if err := proto.Unmarshal(body, doc); err != nil {
+		return nil, fmt.Errorf("failed to decode cached OpenAPI document: %v", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFromKubectlCache(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+	host := "https://10.0.0.1:6443"
+
+	if _, err := NewFromKubectlCache(ctx, cacheDir, host); err == nil {
+		t.Fatal("expected an error for an empty cache")
+	}
+
+	response := []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(widgetOpenAPI), widgetOpenAPI))
+	sum := sha256.Sum256(response)
+	entry := filepath.Join(cacheDir, "http", fmt.Sprintf("%x", sha256.Sum256([]byte(host+"/openapi/v2?timeout=32s"))))
+	if err := os.MkdirAll(filepath.Dir(entry), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entry, append(sum[:], response...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFromKubectlCache(ctx, cacheDir, host)
+	if err != nil {
+		t.Fatalf("failed to create creator from cache: %v", err)
+	}
+	if r.ParseableType(ctx, widgetGVK) == nil {
+		t.Error("expected the cached schema to define Widget")
+	}
+
+	if err := os.WriteFile(entry, append(sum[:], response[:len(response)-1]...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromKubectlCache(ctx, cacheDir, host); err == nil {
+		t.Error("expected an error for a corrupt cache entry")
+	}
+}
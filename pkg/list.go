@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// ListElement returns the element of the associative list at listPath whose
+// key fields equal keys, typed with the list's element type. For a Service,
+// listPath "spec.ports" with keys {port: 80, protocol: TCP} returns that port
+// entry. keys must name exactly the key fields declared by the schema.
+func (r *Creator) ListElement(ctx context.Context, obj *unstructured.Unstructured, listPath string, keys map[string]interface{}) (*typed.TypedValue, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	p, err := ParsePath(listPath)
+	if err != nil {
+		return nil, err
+	}
+	s, list, err := r.associativeList(obj, p)
+	if err != nil {
+		return nil, err
+	}
+	key, err := listKey(list, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", listPath, err)
+	}
+
+	element, ok := valueAtPath(obj.Object, append(p, fieldpath.PathElement{Key: key}))
+	if !ok {
+		return nil, fmt.Errorf("%v: no element with key %v", listPath, fieldpath.PathElement{Key: key})
+	}
+	return typed.AsTyped(value.NewValueInterface(element), s, list.ElementType)
+}
+
+// associativeList returns the schema of the associative list found at p in
+// the type of obj, together with the schema it belongs to.
+func (r *Creator) associativeList(obj *unstructured.Unstructured, p fieldpath.Path) (*mergeDiffSchema.Schema, *mergeDiffSchema.List, error) {
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, root, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+	atom, err := atomAtPath(s, root, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if atom.List == nil || atom.List.ElementRelationship != mergeDiffSchema.Associative || len(atom.List.Keys) == 0 {
+		return nil, nil, fmt.Errorf("%v is not an associative list with keys", FormatPath(p))
+	}
+	return s, atom.List, nil
+}
+
+// listKey builds the key of an element of list from keys, which must name
+// exactly the list's key fields.
+func listKey(list *mergeDiffSchema.List, keys map[string]interface{}) (*value.FieldList, error) {
+	if len(keys) != len(list.Keys) {
+		declared := append([]string(nil), list.Keys...)
+		sort.Strings(declared)
+		return nil, fmt.Errorf("expected values for key fields %v, got %d", declared, len(keys))
+	}
+	key := value.FieldList{}
+	for _, name := range list.Keys {
+		v, ok := keys[name]
+		if !ok {
+			return nil, fmt.Errorf("missing value for key field %q", name)
+		}
+		key = append(key, value.Field{Name: name, Value: value.NewValueInterface(v)})
+	}
+	key.Sort()
+	return &key, nil
+}
+
+// DedupeListElements repairs obj when associative lists or sets hold several
+// elements with the same key, or the same value for sets, which makes the
+// object fail validation and every merge. Duplicates of an associative-list
+// element are merged into the first one according to the element's schema,
+// later duplicates winning conflicting fields; duplicate set values are
+// dropped. It returns the repaired copy of obj and the FormatPath paths of
+// the lists it changed. Lists nested in list elements are repaired first.
+func (r *Creator) DedupeListElements(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, []string, error) {
+	if obj == nil {
+		return nil, nil, fmt.Errorf("object cannot be nil")
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, root, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := &deduper{walker: typedWalker{schema: s}}
+	deduped := obj.DeepCopy()
+	if _, err := d.dedupe(fieldpath.Path{}, root, deduped.Object); err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(d.fixed)
+	return deduped, d.fixed, nil
+}
+
+type deduper struct {
+	walker typedWalker
+	fixed  []string
+}
+
+// dedupe removes the duplicate list elements found in v, of type atom at
+// path, and returns the resulting value.
+func (d *deduper) dedupe(path fieldpath.Path, atom mergeDiffSchema.Atom, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if atom.Map == nil {
+			return v, nil
+		}
+		for k, item := range v {
+			tr := atom.Map.ElementType
+			if field, ok := atom.Map.FindField(k); ok {
+				tr = field.Type
+			}
+			next, ok := d.walker.schema.Resolve(tr)
+			if !ok {
+				continue
+			}
+			name := k
+			deduped, err := d.dedupe(appendPath(path, fieldpath.PathElement{FieldName: &name}), next, item)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = deduped
+		}
+		return v, nil
+	case []interface{}:
+		if atom.List == nil {
+			return v, nil
+		}
+		elemAtom, ok := d.walker.schema.Resolve(atom.List.ElementType)
+		if !ok {
+			return v, nil
+		}
+		if atom.List.ElementRelationship == mergeDiffSchema.Atomic {
+			for i, item := range v {
+				index := i
+				deduped, err := d.dedupe(appendPath(path, fieldpath.PathElement{Index: &index}), elemAtom, item)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = deduped
+			}
+			return v, nil
+		}
+
+		var out []interface{}
+		seen := map[string]int{}
+		for i, item := range v {
+			pe, err := d.walker.listItemPathElement(atom.List, value.NewValueInterface(item))
+			if err != nil {
+				return nil, fmt.Errorf("%v: element %d: %v", FormatPath(path), i, err)
+			}
+			if item, err = d.dedupe(appendPath(path, pe), elemAtom, item); err != nil {
+				return nil, err
+			}
+			first, ok := seen[pe.String()]
+			if !ok {
+				seen[pe.String()] = len(out)
+				out = append(out, item)
+				continue
+			}
+			if len(atom.List.Keys) > 0 {
+				if out[first], err = d.mergeElements(atom.List.ElementType, out[first], item); err != nil {
+					return nil, fmt.Errorf("%v: element %d: %v", FormatPath(path), i, err)
+				}
+			}
+		}
+		if len(out) != len(v) {
+			d.fixed = append(d.fixed, FormatPath(path))
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// mergeElements merges the list element second, of type tr, into first.
+func (d *deduper) mergeElements(tr mergeDiffSchema.TypeRef, first, second interface{}) (interface{}, error) {
+	firstTV, err := typed.AsTyped(value.NewValueInterface(first), d.walker.schema, tr)
+	if err != nil {
+		return nil, err
+	}
+	secondTV, err := typed.AsTyped(value.NewValueInterface(second), d.walker.schema, tr)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := firstTV.Merge(secondTV)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge duplicates: %v", err)
+	}
+	return merged.AsValue().Unstructured(), nil
+}
+
+// sortLists sorts the lists of obj named by the paths of sorts by the values
+// of their keys, as set with WithListSort. Paths absent from obj are skipped.
+func sortLists(obj map[string]interface{}, sorts map[string][]string) error {
+	for path, keys := range sorts {
+		p, err := ParsePath(path)
+		if err != nil {
+			return err
+		}
+		v, ok := valueAtPath(obj, p)
+		if !ok || v == nil {
+			continue
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v: cannot sort, not a list", path)
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return compareByKeys(items[i], items[j], keys) < 0
+		})
+	}
+	return nil
+}
+
+// compareByKeys compares the list items a and b by the values of keys, in
+// turn, like value.Compare. Items that are not maps compare by value.
+func compareByKeys(a, b interface{}, keys []string) int {
+	aMap, aOK := a.(map[string]interface{})
+	bMap, bOK := b.(map[string]interface{})
+	if !aOK || !bOK {
+		return value.Compare(value.NewValueInterface(a), value.NewValueInterface(b))
+	}
+	for _, key := range keys {
+		if c := value.Compare(value.NewValueInterface(aMap[key]), value.NewValueInterface(bMap[key])); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
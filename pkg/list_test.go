@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestListElement(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	element, err := r.ListElement(ctx, object, "spec.ports", map[string]interface{}{"port": 80, "protocol": "TCP"})
+	if err != nil {
+		t.Fatalf("failed to get list element: %v", err)
+	}
+	want := jsonToInterface(`{"name":"http","nodePort":30001,"port":80,"protocol":"TCP","targetPort":80}`)
+	if got := element.AsValue().Unstructured(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected element:\n got: %v\nwant: %v", got, want)
+	}
+
+	for name, keys := range map[string]map[string]interface{}{
+		"no match":    {"port": 81, "protocol": "TCP"},
+		"missing key": {"port": 80},
+		"unknown key": {"port": 80, "name": "http"},
+	} {
+		if _, err := r.ListElement(ctx, object, "spec.ports", keys); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+	if _, err := r.ListElement(ctx, object, "spec.clusterIPs", map[string]interface{}{"ip": "x"}); err == nil {
+		t.Error("expected an error for a list without keys")
+	}
+}
+
+func TestDedupeListElements(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"ports":[{"name":"http","port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"},{"port":80,"protocol":"TCP","nodePort":30001}]}}`)
+	if _, err := r.typedObject(ctx, object); err == nil {
+		t.Fatal("expected the duplicate ports to fail validation")
+	}
+
+	deduped, fixed, err := r.DedupeListElements(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to dedupe: %v", err)
+	}
+	if want := []string{".spec.ports"}; !reflect.DeepEqual(fixed, want) {
+		t.Errorf("expected fixed lists %v, got %v", want, fixed)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"ports":[{"name":"http","nodePort":30001,"port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"}]}}`
+	if got := JsonObjectToString(deduped.Object); got != want {
+		t.Errorf("unexpected deduped object:\n got: %v\nwant: %v", got, want)
+	}
+	if _, err := r.typedObject(ctx, deduped); err != nil {
+		t.Errorf("expected the deduped object to validate: %v", err)
+	}
+	if ports := object.Object["spec"].(map[string]interface{})["ports"].([]interface{}); len(ports) != 3 {
+		t.Error("object was modified")
+	}
+}
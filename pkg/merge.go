@@ -0,0 +1,590 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// CanMerge reports whether extracted can be merged into base as objects of
+// gvk, without modifying either. It first checks both values against the
+// schema for gvk, naming the offending list when an associative-list element
+// omits a key field (the failure hit when merging a plain ExtractItems
+// result), and then performs a trial merge.
+func (r *Creator) CanMerge(ctx context.Context, base, extracted *typed.TypedValue, gvk schema.GroupVersionKind) error {
+	if base == nil || extracted == nil {
+		return fmt.Errorf("base and extracted objects cannot be nil")
+	}
+	objectType := r.ParseableType(ctx, gvk)
+	if objectType == nil {
+		return fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	for _, v := range []struct {
+		name string
+		tv   *typed.TypedValue
+	}{{"base", base}, {"extracted", extracted}} {
+		w := &typedWalker{
+			schema: objectType.Schema,
+			visit:  func(fieldpath.Path, value.Value) error { return nil },
+		}
+		if err := w.walk(fieldpath.Path{}, objectType.TypeRef, v.tv.AsValue()); err != nil {
+			return fmt.Errorf("%v object cannot be merged: %v", v.name, err)
+		}
+	}
+	if _, err := base.Merge(extracted); err != nil {
+		return fmt.Errorf("trial merge failed: %v", err)
+	}
+	return nil
+}
+
+// MergeObjects merges overlay, typically an extraction, into base following
+// the schema for their GVK, and returns the result. Neither input is modified.
+//
+// Lists merge according to their schema:
+//   - Atomic lists are replaced as a whole by the overlay's list; no element
+//     of the base list survives.
+//   - Associative lists and sets keep the order of the base list. Elements
+//     matched by key (or value) are merged in place, and elements only found
+//     in the overlay are appended in overlay order.
+//   - Lists named with WithListSort are then sorted by the given keys.
+//
+// An overlay recorded under another version of the base's group and kind, as
+// happens with version skew during upgrades, is merged as if it were of the
+// base's version: only its apiVersion is rewritten, no conversion takes
+// place. When the schema has both versions, their types must have the same
+// shape, otherwise fields renamed or moved between the versions would merge
+// against the wrong schema and an error is returned. When it lacks the
+// overlay's version, as for versions the cluster no longer serves, such
+// changes cannot be detected; the overlay only has to fit the base's schema.
+// The result keeps the base's apiVersion.
+//
+// The managedFields of the result follow the Creator's ManagedFieldsPolicy,
+// see WithManagedFieldsPolicy; by default they are dropped.
+func (r *Creator) MergeObjects(ctx context.Context, base, overlay *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if base == nil || overlay == nil {
+		return nil, fmt.Errorf("base and overlay objects cannot be nil")
+	}
+	baseGVK, err := ObjectGVK(base)
+	if err != nil {
+		return nil, fmt.Errorf("base: %v", err)
+	}
+	overlayGVK, err := ObjectGVK(overlay)
+	if err != nil {
+		return nil, fmt.Errorf("overlay: %v", err)
+	}
+	if baseGVK.GroupKind() != overlayGVK.GroupKind() {
+		return nil, fmt.Errorf("cannot merge %v into %v", overlayGVK, baseGVK)
+	}
+	if r.managedFieldsPolicy == ManagedFieldsRecompute && r.fieldManager == "" {
+		return nil, fmt.Errorf("recomputing managedFields requires a field manager, see WithFieldManager")
+	}
+	r.trace(TraceEvent{Type: TraceMergeAttempt, GVK: baseGVK})
+	baseTV, err := r.typedObject(ctx, withoutManagedFields(base))
+	if err != nil {
+		r.traceMergeError(baseGVK, err)
+		return nil, err
+	}
+	overlay = withoutManagedFields(overlay)
+	if overlayGVK != baseGVK {
+		if err := r.checkSameShape(baseGVK, overlayGVK); err != nil {
+			r.traceMergeError(baseGVK, err)
+			return nil, err
+		}
+		r.logger(ctx).V(1).Info("Converting overlay to the base version", "from", overlayGVK, "to", baseGVK)
+		overlay.SetAPIVersion(base.GetAPIVersion())
+	}
+	overlayTV, err := r.typedObject(ctx, overlay)
+	if err != nil {
+		r.traceMergeError(baseGVK, err)
+		if overlayGVK != baseGVK {
+			return nil, fmt.Errorf("overlay of %v is not compatible with %v: %v", overlayGVK, baseGVK, err)
+		}
+		return nil, err
+	}
+	merged, err := baseTV.Merge(overlayTV)
+	if err != nil {
+		r.traceMergeError(baseGVK, err)
+		return nil, fmt.Errorf("failed to merge objects: %v", err)
+	}
+	result, err := ToUnstructured(merged)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(result.Object)
+	if err := sortLists(result.Object, r.listSorts); err != nil {
+		return nil, err
+	}
+
+	switch r.managedFieldsPolicy {
+	case ManagedFieldsPreserve:
+		result.SetManagedFields(base.GetManagedFields())
+	case ManagedFieldsRecompute:
+		comparison, err := baseTV.Compare(merged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare objects: %v", err)
+		}
+		changed := comparison.Modified.Union(comparison.Added).Leaves().Difference(strippedFields)
+		entries, err := updatedManagedFields(base.GetManagedFields(), changed, r.fieldManager, base.GetAPIVersion())
+		if err != nil {
+			return nil, err
+		}
+		result.SetManagedFields(entries)
+	}
+	return result, nil
+}
+
+// ManagedFieldsPolicy decides the managedFields of the objects returned by
+// MergeObjects. The managedFields of the inputs never take part in the merge
+// itself.
+type ManagedFieldsPolicy int
+
+const (
+	// ManagedFieldsDrop returns merged objects without managedFields.
+	ManagedFieldsDrop ManagedFieldsPolicy = iota
+	// ManagedFieldsPreserve keeps the managedFields of the base object.
+	ManagedFieldsPreserve
+	// ManagedFieldsRecompute records the merge as an Update by the manager set
+	// with WithFieldManager, like the apiserver would: the manager takes
+	// ownership of the fields the overlay changed, away from the base's
+	// other managers.
+	ManagedFieldsRecompute
+)
+
+// updatedManagedFields returns entries after an Update by manager that
+// changed the leaf fields in changed. Other managers lose the changed fields,
+// and entries left empty are dropped.
+func updatedManagedFields(entries []metav1.ManagedFieldsEntry, changed *fieldpath.Set, manager, apiVersion string) ([]metav1.ManagedFieldsEntry, error) {
+	if changed.Empty() {
+		return entries, nil
+	}
+	var updated []metav1.ManagedFieldsEntry
+	found := false
+	for _, entry := range entries {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Manager == manager && entry.Operation == metav1.ManagedFieldsOperationUpdate && entry.Subresource == "" {
+			set, found = set.Union(changed), true
+		} else if set = set.Difference(changed); set.Leaves().Empty() {
+			continue
+		}
+		if entry.FieldsV1, err = fieldsV1(set); err != nil {
+			return nil, err
+		}
+		updated = append(updated, entry)
+	}
+	if !found {
+		raw, err := fieldsV1(changed)
+		if err != nil {
+			return nil, err
+		}
+		now := metav1.Now()
+		updated = append(updated, metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: apiVersion,
+			Time:       &now,
+			FieldsType: "FieldsV1",
+			FieldsV1:   raw,
+		})
+	}
+	return updated, nil
+}
+
+// MergePair is a base object and the overlay to merge into it.
+type MergePair struct {
+	Base    *unstructured.Unstructured
+	Overlay *unstructured.Unstructured
+}
+
+// BatchError is returned by MergeObjectsBatch and ExtractFromList when some
+// of their items fail. Errors is indexed like the items and holds nil for the
+// items that succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var failed []string
+	for i, err := range e.Errors {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("item %d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("%d of %d item(s) failed: %v", len(failed), len(e.Errors), strings.Join(failed, "; "))
+}
+
+// checkSameShape returns an error if the schema has types for both gvk and
+// other and they differ in shape, names of the types aside.
+func (r *Creator) checkSameShape(gvk, other schema.GroupVersionKind) error {
+	s, gvkToTypeNameMap := r.types()
+	typeName, ok := gvkToTypeNameMap[gvk]
+	if !ok {
+		return nil
+	}
+	otherTypeName, ok := gvkToTypeNameMap[other]
+	if !ok {
+		return nil
+	}
+	if !sameShape(s, mergeDiffSchema.TypeRef{NamedType: &typeName}, mergeDiffSchema.TypeRef{NamedType: &otherTypeName}, map[[2]string]bool{}) {
+		return fmt.Errorf("cannot merge %v into %v: the schemas of the versions differ", other, gvk)
+	}
+	return nil
+}
+
+// sameShape reports whether a and b resolve to types of the same shape:
+// the same fields, scalars and list and map relationships, whatever the
+// names of the types. seen holds the pairs of named types being compared, so
+// recursive types are followed once.
+func sameShape(s *mergeDiffSchema.Schema, a, b mergeDiffSchema.TypeRef, seen map[[2]string]bool) bool {
+	if a.NamedType != nil && b.NamedType != nil {
+		if *a.NamedType == *b.NamedType {
+			return true
+		}
+		pair := [2]string{*a.NamedType, *b.NamedType}
+		if seen[pair] {
+			return true
+		}
+		seen[pair] = true
+	}
+	aAtom, aOK := s.Resolve(a)
+	bAtom, bOK := s.Resolve(b)
+	if !aOK || !bOK {
+		return aOK == bOK
+	}
+	if describeAtom(aAtom) != describeAtom(bAtom) {
+		return false
+	}
+	if aAtom.List != nil && !sameShape(s, aAtom.List.ElementType, bAtom.List.ElementType, seen) {
+		return false
+	}
+	if aAtom.Map == nil {
+		return true
+	}
+	if len(aAtom.Map.Fields) != len(bAtom.Map.Fields) || !sameShape(s, aAtom.Map.ElementType, bAtom.Map.ElementType, seen) {
+		return false
+	}
+	for _, field := range aAtom.Map.Fields {
+		other, ok := bAtom.Map.FindField(field.Name)
+		if !ok || !sameShape(s, field.Type, other.Type, seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeObjectsBatch merges the overlay of each pair into its base like
+// MergeObjects, sharing the Creator's schema across the batch. A failed merge
+// does not stop the others: the results are indexed like pairs, with nil for
+// the failed merges, and the failures are returned together as a *BatchError.
+func (r *Creator) MergeObjectsBatch(ctx context.Context, pairs []MergePair) ([]*unstructured.Unstructured, error) {
+	results := make([]*unstructured.Unstructured, len(pairs))
+	errs := make([]error, len(pairs))
+	failed := false
+	for i, pair := range pairs {
+		if results[i], errs[i] = r.MergeObjects(ctx, pair.Base, pair.Overlay); errs[i] != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return results, &BatchError{Errors: errs}
+	}
+	return results, nil
+}
+
+// MergeObjectsWithOwnership merges overlay into base like MergeObjects and
+// also returns the leaf fields manager would newly own: those set by overlay
+// that base's managedFields do not already attribute to manager. Fields never
+// recorded in managedFields, such as metadata.name, are left out. The
+// managedFields of the merged object follow the Creator's
+// ManagedFieldsPolicy.
+func (r *Creator) MergeObjectsWithOwnership(ctx context.Context, base, overlay *unstructured.Unstructured, manager string) (*unstructured.Unstructured, *fieldpath.Set, error) {
+	if base == nil || overlay == nil {
+		return nil, nil, fmt.Errorf("base and overlay objects cannot be nil")
+	}
+	overlay = withoutManagedFields(overlay)
+	merged, err := r.MergeObjects(ctx, base, overlay)
+	if err != nil {
+		return nil, nil, err
+	}
+	overlayTV, err := r.typedObject(ctx, overlay)
+	if err != nil {
+		return nil, nil, err
+	}
+	overlaySet, err := overlayTV.ToFieldSet()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compute overlay field set: %v", err)
+	}
+	owned := fieldpath.NewSet()
+	for _, entry := range base.GetManagedFields() {
+		if entry.Manager != manager {
+			continue
+		}
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		owned = owned.Union(set)
+	}
+	return merged, overlaySet.Leaves().Difference(strippedFields).Difference(owned), nil
+}
+
+// MergeWithResolver merges overlay into base like TypedValue.Merge, but lets
+// resolve decide the value of every scalar both sides set to different
+// values, e.g. to keep the base value or compute a new one. resolve is not
+// called for fields set on one side only, or for atomic lists and maps, which
+// the overlay replaces as usual. A nil result keeps the overlay value.
+func (r *Creator) MergeWithResolver(ctx context.Context, base, overlay *typed.TypedValue, resolve func(path fieldpath.Path, baseVal, overlayVal value.Value) value.Value) (*typed.TypedValue, error) {
+	if base == nil || overlay == nil {
+		return nil, fmt.Errorf("base and overlay objects cannot be nil")
+	}
+	if resolve == nil {
+		return base.Merge(overlay)
+	}
+	comparison, err := base.Compare(overlay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare objects: %v", err)
+	}
+	if comparison.Modified.Empty() {
+		return base.Merge(overlay)
+	}
+
+	log := r.logger(ctx)
+	baseU := base.AsValue().Unstructured()
+	overlayU := runtime.DeepCopyJSONValue(overlay.AsValue().Unstructured())
+	comparison.Modified.Iterate(func(p fieldpath.Path) {
+		baseVal, ok := valueAtPath(baseU, p)
+		if !ok || !isScalar(baseVal) {
+			return
+		}
+		overlayVal, ok := valueAtPath(overlayU, p)
+		if !ok || !isScalar(overlayVal) {
+			return
+		}
+		resolved := resolve(p, value.NewValueInterface(baseVal), value.NewValueInterface(overlayVal))
+		if resolved == nil {
+			return
+		}
+		log.V(1).Info("Resolved merge conflict", "path", FormatPath(p))
+		setValueAtPath(overlayU, p, resolved.Unstructured())
+	})
+	resolvedOverlay, err := typed.AsTyped(value.NewValueInterface(overlayU), overlay.Schema(), overlay.TypeRef())
+	if err != nil {
+		return nil, fmt.Errorf("resolved overlay does not match schema: %v", err)
+	}
+	return base.Merge(resolvedOverlay)
+}
+
+// isScalar reports whether the unstructured value v is neither a map nor a
+// list.
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// MergeDiagnosis reports why an extracted object cannot be merged.
+type MergeDiagnosis struct {
+	// MissingKeys lists, per object and associative list, the key fields
+	// that elements of the base or extracted object omit.
+	MissingKeys []MissingListKeys
+}
+
+// Mergeable reports whether the diagnosis found no problem.
+func (d *MergeDiagnosis) Mergeable() bool {
+	return len(d.MissingKeys) == 0
+}
+
+// MissingListKeys describes the elements of one associative list that omit
+// key fields.
+type MissingListKeys struct {
+	// Side is the object holding the list as passed to DiagnoseMerge, "base"
+	// or "extracted".
+	Side string
+	// List is the path of the list, in the FormatPath syntax. Elements of
+	// enclosing lists that omit keys themselves are addressed by index.
+	List string
+	// Fields are the key fields omitted by at least one element, sorted.
+	Fields []string
+	// Elements is the number of elements omitting key fields.
+	Elements int
+}
+
+// MissingKey is an associative-list element that omits key fields.
+type MissingKey struct {
+	// List is the path of the list, as on MissingListKeys.
+	List string
+	// Index is the position of the element in the list.
+	Index int
+	// Fields are the key fields the element omits, in schema order.
+	Fields []string
+}
+
+// MissingListKeys returns every associative-list element of fragment, an
+// object of gvk, that omits key fields, such as the nodePort-only port of a
+// plain ExtractItems result. Merging fragment fails on each of them; callers
+// can decide to repair it, e.g. with ExtractItemsWithKeys, or reject it. Keys
+// with a schema default are not required. Elements are sorted by list, then
+// index.
+func (r *Creator) MissingListKeys(ctx context.Context, fragment *typed.TypedValue, gvk schema.GroupVersionKind) ([]MissingKey, error) {
+	if fragment == nil {
+		return nil, fmt.Errorf("fragment cannot be nil")
+	}
+	objectType := r.ParseableType(ctx, gvk)
+	if objectType == nil {
+		return nil, fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	if tr := fragment.TypeRef(); !tr.Equals(&objectType.TypeRef) {
+		return nil, fmt.Errorf("fragment is not of GVK %v", gvk)
+	}
+	d := &keyDiagnoser{
+		walker:  typedWalker{schema: objectType.Schema},
+		missing: map[string]*MissingListKeys{},
+	}
+	d.diagnose(fieldpath.Path{}, objectType.TypeRef, fragment.AsValue())
+	sort.Slice(d.elements, func(i, j int) bool {
+		if d.elements[i].List != d.elements[j].List {
+			return d.elements[i].List < d.elements[j].List
+		}
+		return d.elements[i].Index < d.elements[j].Index
+	})
+	return d.elements, nil
+}
+
+// DiagnoseMerge analyzes base and extracted for the problems that make merging
+// extracted into base fail, without merging. It currently finds
+// associative-list elements omitting key fields, the "element ... omits key
+// field" error hit when merging a plain ExtractItems result, in either object;
+// each finding names its side. Keys with a schema default are not required.
+// Both objects must be of gvk.
+func (r *Creator) DiagnoseMerge(ctx context.Context, base, extracted *typed.TypedValue, gvk schema.GroupVersionKind) (*MergeDiagnosis, error) {
+	if base == nil || extracted == nil {
+		return nil, fmt.Errorf("base and extracted objects cannot be nil")
+	}
+	objectType := r.ParseableType(ctx, gvk)
+	if objectType == nil {
+		return nil, fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	for _, tv := range []*typed.TypedValue{base, extracted} {
+		if tr := tv.TypeRef(); !tr.Equals(&objectType.TypeRef) {
+			return nil, fmt.Errorf("object is not of GVK %v", gvk)
+		}
+	}
+
+	diagnosis := &MergeDiagnosis{}
+	for _, side := range []struct {
+		name string
+		tv   *typed.TypedValue
+	}{{"base", base}, {"extracted", extracted}} {
+		d := &keyDiagnoser{
+			walker:  typedWalker{schema: objectType.Schema},
+			side:    side.name,
+			missing: map[string]*MissingListKeys{},
+		}
+		d.diagnose(fieldpath.Path{}, objectType.TypeRef, side.tv.AsValue())
+		for _, m := range d.missing {
+			sort.Strings(m.Fields)
+			diagnosis.MissingKeys = append(diagnosis.MissingKeys, *m)
+		}
+	}
+	sort.Slice(diagnosis.MissingKeys, func(i, j int) bool {
+		a, b := diagnosis.MissingKeys[i], diagnosis.MissingKeys[j]
+		if a.List != b.List {
+			return a.List < b.List
+		}
+		return a.Side < b.Side
+	})
+	return diagnosis, nil
+}
+
+// keyDiagnoser collects the associative-list elements omitting key fields,
+// both per list and per element.
+type keyDiagnoser struct {
+	walker   typedWalker
+	side     string
+	missing  map[string]*MissingListKeys
+	elements []MissingKey
+}
+
+func (d *keyDiagnoser) diagnose(path fieldpath.Path, tr mergeDiffSchema.TypeRef, v value.Value) {
+	if v == nil || v.IsNull() {
+		return
+	}
+	atom, ok := d.walker.schema.Resolve(tr)
+	if !ok {
+		return
+	}
+	switch {
+	case v.IsMap() && atom.Map != nil:
+		v.AsMap().Iterate(func(k string, item value.Value) bool {
+			fieldType := atom.Map.ElementType
+			if field, ok := atom.Map.FindField(k); ok {
+				fieldType = field.Type
+			}
+			name := k
+			d.diagnose(appendPath(path, fieldpath.PathElement{FieldName: &name}), fieldType, item)
+			return true
+		})
+	case v.IsList() && atom.List != nil && atom.List.ElementRelationship != mergeDiffSchema.Atomic:
+		l := v.AsList()
+		for i := 0; i < l.Length(); i++ {
+			item := l.At(i)
+			pe, err := d.walker.listItemPathElement(atom.List, item)
+			if err != nil {
+				d.recordMissing(path, atom.List, i, item)
+				index := i
+				pe = fieldpath.PathElement{Index: &index}
+			}
+			d.diagnose(appendPath(path, pe), atom.List.ElementType, item)
+		}
+	}
+}
+
+// recordMissing records the key fields of l that item, at index, omits.
+func (d *keyDiagnoser) recordMissing(path fieldpath.Path, l *mergeDiffSchema.List, index int, item value.Value) {
+	list := FormatPath(path)
+	m, ok := d.missing[list]
+	if !ok {
+		m = &MissingListKeys{Side: d.side, List: list}
+		d.missing[list] = m
+	}
+	m.Elements++
+	element := MissingKey{List: list, Index: index}
+	for _, name := range l.Keys {
+		if item.IsMap() {
+			if _, ok := item.AsMap().Get(name); ok {
+				continue
+			}
+		}
+		if _, ok := d.walker.keyDefault(l, name); ok {
+			continue
+		}
+		element.Fields = append(element.Fields, name)
+		if !containsString(m.Fields, name) {
+			m.Fields = append(m.Fields, name)
+		}
+	}
+	d.elements = append(d.elements, element)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,427 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+func TestCanMerge(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	base, err := r.typedObject(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to convert object: %v", err)
+	}
+	set, err := managerSet(object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to read managed fields: %v", err)
+	}
+
+	// The plain extraction from TestIssue drops the port list keys.
+	err = r.CanMerge(ctx, base, base.ExtractItems(set.Leaves()), serviceGVK)
+	if err == nil {
+		t.Fatal("expected an error for an element without its list keys")
+	}
+	if msg := err.Error(); !strings.Contains(msg, ".spec.ports") || !strings.Contains(msg, "omits key field") {
+		t.Errorf("error does not name the offending list: %v", err)
+	}
+
+	if err := r.CanMerge(ctx, base, ExtractItemsWithKeys(base, set), serviceGVK); err != nil {
+		t.Errorf("expected extraction with keys to be mergeable: %v", err)
+	}
+}
+
+func TestMergeObjectsListOrder(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	base := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ipFamilies":["IPv4","IPv6"],"ports":[{"name":"https","port":443,"protocol":"TCP"},{"name":"http","port":80,"protocol":"TCP"},{"name":"dns","port":53,"protocol":"UDP"}]}}`)
+	overlay := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ipFamilies":["IPv6"],"ports":[{"nodePort":30001,"port":80,"protocol":"TCP"}]}}`)
+
+	merged, err := r.MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ipFamilies":["IPv6"],"ports":[{"name":"https","port":443,"protocol":"TCP"},{"name":"http","nodePort":30001,"port":80,"protocol":"TCP"},{"name":"dns","port":53,"protocol":"UDP"}]}}`)
+	if JsonObjectToString(merged.Object) != JsonObjectToString(want) {
+		t.Errorf("unexpected merge result:\n got: %s\nwant: %s", JsonObjectToString(merged.Object), JsonObjectToString(want))
+	}
+}
+
+func TestMergeObjectsWithListSort(t *testing.T) {
+	ctx := context.Background()
+	base := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ports":[{"port":443,"protocol":"TCP"},{"port":53,"protocol":"UDP"},{"port":53,"protocol":"TCP"}]}}`)
+	overlay := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ports":[{"port":8080,"protocol":"TCP"},{"port":80,"protocol":"TCP"}]}}`)
+
+	tests := map[string]struct {
+		opts []Option
+		want string
+	}{
+		"no hint keeps merge order": {
+			want: `[{"port":443,"protocol":"TCP"},{"port":53,"protocol":"UDP"},{"port":53,"protocol":"TCP"},{"port":8080,"protocol":"TCP"},{"port":80,"protocol":"TCP"}]`,
+		},
+		"sorted by port": {
+			opts: []Option{WithListSort("spec.ports", []string{"port"})},
+			want: `[{"port":53,"protocol":"UDP"},{"port":53,"protocol":"TCP"},{"port":80,"protocol":"TCP"},{"port":443,"protocol":"TCP"},{"port":8080,"protocol":"TCP"}]`,
+		},
+		"sorted by port and protocol": {
+			opts: []Option{WithListSort("spec.ports", []string{"port", "protocol"})},
+			want: `[{"port":53,"protocol":"TCP"},{"port":53,"protocol":"UDP"},{"port":80,"protocol":"TCP"},{"port":443,"protocol":"TCP"},{"port":8080,"protocol":"TCP"}]`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			merged, err := newTestCreator(t, test.opts...).MergeObjects(ctx, base, overlay)
+			if err != nil {
+				t.Fatalf("failed to merge: %v", err)
+			}
+			ports, _, _ := unstructured.NestedSlice(merged.Object, "spec", "ports")
+			if got := JsonObjectToString(ports); got != test.want {
+				t.Errorf("unexpected ports:\n got: %v\nwant: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeWithResolver(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	base, err := r.typedObject(ctx, jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"type":"NodePort","sessionAffinity":"None","ports":[{"port":80,"protocol":"TCP","nodePort":30001}]}}`))
+	if err != nil {
+		t.Fatalf("failed to convert base: %v", err)
+	}
+	overlay, err := r.typedObject(ctx, jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"type":"LoadBalancer","sessionAffinity":"None","ports":[{"port":80,"protocol":"TCP","nodePort":30002,"name":"http"}]}}`))
+	if err != nil {
+		t.Fatalf("failed to convert overlay: %v", err)
+	}
+
+	var resolved []string
+	merged, err := r.MergeWithResolver(ctx, base, overlay, func(p fieldpath.Path, baseVal, _ value.Value) value.Value {
+		resolved = append(resolved, FormatPath(p))
+		return baseVal
+	})
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"type":"NodePort","sessionAffinity":"None","ports":[{"name":"http","port":80,"protocol":"TCP","nodePort":30001}]}}`)
+	if got := merged.AsValue().Unstructured(); JsonObjectToString(got) != JsonObjectToString(want) {
+		t.Errorf("unexpected merge result:\n got: %v\nwant: %v", JsonObjectToString(got), JsonObjectToString(want))
+	}
+	sort.Strings(resolved)
+	if wantResolved := []string{`.spec.ports[port=80,protocol="TCP"].nodePort`, ".spec.type"}; !reflect.DeepEqual(resolved, wantResolved) {
+		t.Errorf("expected the resolver to be called for %v, got %v", wantResolved, resolved)
+	}
+}
+
+func TestMergeObjectsVersionSkew(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	base := jsonToUnstructured(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},"spec":{"replicas":1,"template":{"spec":{"containers":[{"name":"web","image":"nginx:1.24"}]}}}}`)
+	overlay := jsonToUnstructured(`{"apiVersion":"apps/v1beta2","kind":"Deployment","metadata":{"name":"web"},"spec":{"template":{"spec":{"containers":[{"name":"web","image":"nginx:1.25"}]}}}}`)
+
+	merged, err := r.MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},"spec":{"replicas":1,"template":{"spec":{"containers":[{"name":"web","image":"nginx:1.25"}]}}}}`)
+	if JsonObjectToString(merged.Object) != JsonObjectToString(want) {
+		t.Errorf("unexpected merge result:\n got: %s\nwant: %s", JsonObjectToString(merged.Object), JsonObjectToString(want))
+	}
+	if overlay.GetAPIVersion() != "apps/v1beta2" {
+		t.Error("overlay was modified")
+	}
+
+	incompatible := jsonToUnstructured(`{"apiVersion":"apps/v1beta2","kind":"Deployment","metadata":{"name":"web"},"spec":{"replicas":"one"}}`)
+	if _, err := r.MergeObjects(ctx, base, incompatible); err == nil {
+		t.Error("expected an error for an overlay that does not fit the base schema")
+	}
+	other := jsonToUnstructured(`{"apiVersion":"apps/v1","kind":"StatefulSet","metadata":{"name":"web"}}`)
+	if _, err := r.MergeObjects(ctx, base, other); err == nil {
+		t.Error("expected an error for a different kind")
+	}
+}
+
+// gadgetVersionsOpenAPI describes a Gadget whose v1beta1 has the shape of v1
+// and whose v2 renamed spec.size to spec.replicas.
+const gadgetVersionsOpenAPI = `{
+  "swagger": "2.0",
+  "info": {"title": "gadgets", "version": "v1"},
+  "paths": {},
+  "definitions": {
+    "com.example.v1beta1.Gadget": {
+      "type": "object",
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1beta1", "kind": "Gadget"}],
+      "properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}, "spec": {"$ref": "#/definitions/com.example.v1beta1.GadgetSpec"}}
+    },
+    "com.example.v1beta1.GadgetSpec": {"type": "object", "properties": {"size": {"type": "integer"}}},
+    "com.example.v1.Gadget": {
+      "type": "object",
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "Gadget"}],
+      "properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}, "spec": {"$ref": "#/definitions/com.example.v1.GadgetSpec"}}
+    },
+    "com.example.v1.GadgetSpec": {"type": "object", "properties": {"size": {"type": "integer"}}},
+    "com.example.v2.Gadget": {
+      "type": "object",
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v2", "kind": "Gadget"}],
+      "properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}, "spec": {"type": "object", "properties": {"replicas": {"type": "integer"}}}}
+    }
+  }
+}`
+
+func TestMergeObjectsVersionShape(t *testing.T) {
+	ctx := context.Background()
+	r, err := NewFromOpenAPIBytes(ctx, []byte(gadgetVersionsOpenAPI))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	base := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Gadget","spec":{"size":1}}`)
+
+	sameShape := jsonToUnstructured(`{"apiVersion":"example.com/v1beta1","kind":"Gadget","spec":{"size":2}}`)
+	merged, err := r.MergeObjects(ctx, base, sameShape)
+	if err != nil {
+		t.Fatalf("failed to merge a version of the same shape: %v", err)
+	}
+	if size, _, _ := unstructured.NestedInt64(merged.Object, "spec", "size"); size != 2 {
+		t.Errorf("expected the overlay size, got %v", merged.Object)
+	}
+
+	renamed := jsonToUnstructured(`{"apiVersion":"example.com/v2","kind":"Gadget","spec":{"replicas":2}}`)
+	if _, err := r.MergeObjects(ctx, base, renamed); err == nil || !strings.Contains(err.Error(), "schemas of the versions differ") {
+		t.Errorf("expected an error for versions of different shapes, got %v", err)
+	}
+}
+
+func TestDiagnoseMerge(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	base, err := r.typedObject(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to convert object: %v", err)
+	}
+	set, err := managerSet(object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to read managed fields: %v", err)
+	}
+	// The failing fragment from TestIssue: {"spec":{"ports":[{"nodePort":30001}]}}.
+	extracted := base.ExtractItems(set.Leaves())
+
+	diagnosis, err := r.DiagnoseMerge(ctx, base, extracted, serviceGVK)
+	if err != nil {
+		t.Fatalf("failed to diagnose: %v", err)
+	}
+	want := []MissingListKeys{{Side: "extracted", List: ".spec.ports", Fields: []string{"port", "protocol"}, Elements: 1}}
+	if !reflect.DeepEqual(diagnosis.MissingKeys, want) {
+		t.Errorf("unexpected diagnosis:\n got: %+v\nwant: %+v", diagnosis.MissingKeys, want)
+	}
+	if diagnosis.Mergeable() {
+		t.Error("expected the fragment not to be mergeable")
+	}
+
+	diagnosis, err = r.DiagnoseMerge(ctx, extracted, base, serviceGVK)
+	if err != nil {
+		t.Fatalf("failed to diagnose: %v", err)
+	}
+	want = []MissingListKeys{{Side: "base", List: ".spec.ports", Fields: []string{"port", "protocol"}, Elements: 1}}
+	if !reflect.DeepEqual(diagnosis.MissingKeys, want) {
+		t.Errorf("expected the base to be diagnosed:\n got: %+v\nwant: %+v", diagnosis.MissingKeys, want)
+	}
+
+	diagnosis, err = r.DiagnoseMerge(ctx, base, base, serviceGVK)
+	if err != nil {
+		t.Fatalf("failed to diagnose: %v", err)
+	}
+	if !diagnosis.Mergeable() {
+		t.Errorf("expected no problem, got %+v", diagnosis.MissingKeys)
+	}
+}
+
+func TestMissingListKeys(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	// The failing fragment from TestIssue: {"spec":{"ports":[{"nodePort":30001}]}}.
+	object := jsonToUnstructured(issueServiceJSON)
+	base, err := r.typedObject(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to convert object: %v", err)
+	}
+	set, err := managerSet(object, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to read managed fields: %v", err)
+	}
+	fragment := base.ExtractItems(set.Leaves())
+
+	missing, err := r.MissingListKeys(ctx, fragment, serviceGVK)
+	if err != nil {
+		t.Fatalf("failed to analyze fragment: %v", err)
+	}
+	want := []MissingKey{{List: ".spec.ports", Index: 0, Fields: []string{"port", "protocol"}}}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("unexpected missing keys:\n got: %+v\nwant: %+v", missing, want)
+	}
+
+	repaired := ExtractItemsWithKeys(base, set.Leaves())
+	if missing, err = r.MissingListKeys(ctx, repaired, serviceGVK); err != nil || len(missing) != 0 {
+		t.Errorf("expected no missing keys after repair, got %+v, %v", missing, err)
+	}
+	if _, err := r.MissingListKeys(ctx, fragment, appsv1.SchemeGroupVersion.WithKind("Deployment")); err == nil {
+		t.Error("expected an error for a fragment of another GVK")
+	}
+}
+func TestMergeObjectsWithOwnership(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	base := jsonToUnstructured(issueServiceJSON)
+	overlay := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service","labels":{"team":"web"}},"spec":{"ports":[{"port":80,"protocol":"TCP","nodePort":30002}]}}`)
+
+	merged, owned, err := r.MergeObjectsWithOwnership(ctx, base, overlay, "port-allocator")
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if nodePort, _, _ := unstructured.NestedSlice(merged.Object, "spec", "ports"); fmt.Sprint(nodePort[0].(map[string]interface{})["nodePort"]) != "30002" {
+		t.Errorf("expected the overlay nodePort to be merged, got %v", nodePort)
+	}
+	want := fieldpath.NewSet(
+		fieldpath.MakePathOrDie("metadata", "labels", "team"),
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort"),
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "port"),
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "protocol"),
+	)
+	if !owned.Equals(want) {
+		t.Errorf("unexpected ownership delta:\n got: %v\nwant: %v", FormatSet(owned), FormatSet(want))
+	}
+
+	_, owned, err = r.MergeObjectsWithOwnership(ctx, base, overlay, "kubectl-edit")
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if owned.Has(fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")) {
+		t.Error("expected nodePort, already owned by kubectl-edit, to be left out")
+	}
+}
+
+func TestMergeObjectsBatch(t *testing.T) {
+	r := newTestCreator(t)
+	base := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"ClusterIP"}}`)
+	pairs := []MergePair{
+		{Base: base, Overlay: jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"type":"NodePort"}}`)},
+		{Base: base, Overlay: jsonToUnstructured(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"}}`)},
+		{Base: base, Overlay: jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","labels":{"app":"web"}}}`)},
+	}
+
+	results, err := r.MergeObjectsBatch(context.Background(), pairs)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a *BatchError, got %v", err)
+	}
+	if batchErr.Errors[0] != nil || batchErr.Errors[1] == nil || batchErr.Errors[2] != nil {
+		t.Errorf("expected only the second pair to fail, got %v", batchErr.Errors)
+	}
+	if len(results) != len(pairs) || results[1] != nil {
+		t.Fatalf("expected a nil result for the failed pair, got %v", results)
+	}
+	if got, _, _ := unstructured.NestedString(results[0].Object, "spec", "type"); got != "NodePort" {
+		t.Errorf("expected the first merge to set spec.type, got %q", got)
+	}
+	if got := results[2].GetLabels()["app"]; got != "web" {
+		t.Errorf("expected the third merge to set the label, got %q", got)
+	}
+
+	if _, err := r.MergeObjectsBatch(context.Background(), pairs[:1]); err != nil {
+		t.Errorf("expected no error when every merge succeeds, got %v", err)
+	}
+}
+
+func TestToTypedObject(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	object.SetManagedFields(nil)
+
+	base, err := r.typedObject(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+	overlay, err := r.typedObject(ctx, jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"clear-nginx-service"},"spec":{"ports":[{"nodePort":30002,"port":80,"protocol":"TCP"}]}}`))
+	if err != nil {
+		t.Fatalf("failed to parse overlay: %v", err)
+	}
+	merged, err := base.Merge(overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+
+	svc := &corev1.Service{}
+	if err := ToTypedObject(merged, svc); err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if svc.Name != "clear-nginx-service" || svc.Spec.Type != corev1.ServiceTypeNodePort || len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].NodePort != 30002 {
+		t.Errorf("unexpected Service: %+v", svc)
+	}
+
+	if err := ToTypedObject(merged, &appsv1.Deployment{}); err == nil {
+		t.Error("expected an error converting a Service to a Deployment")
+	}
+
+	malformed, err := r.ParseableType(ctx, serviceGVK).FromUnstructured(jsonToInterface(`{"apiVersion":"a/b/c","kind":"Service"}`))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+	if err := ToTypedObject(malformed, &corev1.Service{}); err == nil || !strings.Contains(err.Error(), "invalid apiVersion") {
+		t.Errorf("expected an invalid apiVersion error, got %v", err)
+	}
+}
+
+func TestWithManagedFieldsPolicy(t *testing.T) {
+	ctx := context.Background()
+	base := jsonToUnstructured(issueServiceJSON)
+	overlay := jsonToUnstructured(issueNodePortConfig)
+	overlay.SetManagedFields(base.GetManagedFields()[:1])
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")
+
+	merged, err := newTestCreator(t).MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if entries := merged.GetManagedFields(); len(entries) != 0 {
+		t.Errorf("expected managedFields to be dropped by default, got %v", entries)
+	}
+
+	merged, err = newTestCreator(t, WithManagedFieldsPolicy(ManagedFieldsPreserve)).MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if !reflect.DeepEqual(merged.GetManagedFields(), base.GetManagedFields()) {
+		t.Errorf("expected the base managedFields to be preserved, got %v", merged.GetManagedFields())
+	}
+
+	if _, err := newTestCreator(t, WithManagedFieldsPolicy(ManagedFieldsRecompute)).MergeObjects(ctx, base, overlay); err == nil {
+		t.Error("expected an error recomputing managedFields without a field manager")
+	}
+	merged, err = newTestCreator(t, WithManagedFieldsPolicy(ManagedFieldsRecompute), WithFieldManager("merger")).MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if set := managerFieldSet(t, merged, "merger", metav1.ManagedFieldsOperationUpdate); set == nil || !set.Equals(fieldpath.NewSet(nodePort)) {
+		t.Errorf("expected merger to own the changed nodePort only, got %v", set)
+	}
+	if set := managerFieldSet(t, merged, "kubectl-edit", metav1.ManagedFieldsOperationUpdate); set != nil {
+		t.Errorf("expected kubectl-edit to lose its only field, still owns %v", set)
+	}
+	if set := managerFieldSet(t, merged, "kubectl-client-side-apply", metav1.ManagedFieldsOperationUpdate); set == nil || !set.Has(fieldpath.MakePathOrDie("spec", "type")) {
+		t.Errorf("expected kubectl-client-side-apply to keep its fields, got %v", set)
+	}
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// defaultMinifyStrip lists the fields Minify removes unless WithMinifyStrip
+// says otherwise: status and the metadata the apiserver populates.
+var defaultMinifyStrip = []string{
+	"status",
+	"metadata.managedFields",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.creationTimestamp",
+	"metadata.generation",
+	"metadata.selfLink",
+}
+
+// Minify returns a minimal copy of obj that can be applied again, like a
+// cleaned up "kubectl get -o yaml": status, managedFields and the metadata
+// populated by the apiserver are removed, see WithMinifyStrip, and so are
+// fields set to the default their schema declares. List keys are kept even
+// when defaulted, as the list elements could not be told apart otherwise.
+func (r *Creator) Minify(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, err
+	}
+	set, err := r.minifyStripSet()
+	if err != nil {
+		return nil, err
+	}
+	minified, err := r.Subtract(ctx, obj, set)
+	if err != nil {
+		return nil, err
+	}
+	removeDefaults(s, atom, minified.Object, nil)
+	return minified, nil
+}
+
+// minifyStripSet returns the fields Minify removes regardless of their
+// value.
+func (r *Creator) minifyStripSet() (*fieldpath.Set, error) {
+	strip := r.minifyStrip
+	if strip == nil {
+		strip = defaultMinifyStrip
+	}
+	return ParsePaths(strip)
+}
+
+// removeDefaults removes from v the fields set to the default declared by
+// atom, or by the types of the fields and items below it, except for the
+// fields named in keys.
+func removeDefaults(s *mergeDiffSchema.Schema, atom mergeDiffSchema.Atom, v interface{}, keys []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if atom.Map == nil {
+			return
+		}
+		for _, field := range atom.Map.Fields {
+			item, ok := v[field.Name]
+			if !ok || field.Default == nil || containsString(keys, field.Name) {
+				continue
+			}
+			if value.Equals(value.NewValueInterface(item), value.NewValueInterface(jsonDefault(field.Default))) {
+				delete(v, field.Name)
+			}
+		}
+		for k, item := range v {
+			tr := atom.Map.ElementType
+			if field, ok := atom.Map.FindField(k); ok {
+				tr = field.Type
+			}
+			if next, ok := s.Resolve(tr); ok {
+				removeDefaults(s, next, item, nil)
+			}
+		}
+	case []interface{}:
+		if atom.List == nil {
+			return
+		}
+		next, ok := s.Resolve(atom.List.ElementType)
+		if !ok {
+			return
+		}
+		var keys []string
+		if atom.List.ElementRelationship == mergeDiffSchema.Associative {
+			keys = atom.List.Keys
+		}
+		for _, item := range v {
+			removeDefaults(s, next, item, keys)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMinify(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	object.SetUID("6c0f2a1e-8a4b-4d7e-9a57-0d3c2f1b9e01")
+	object.SetResourceVersion("2841")
+	object.SetGeneration(1)
+	object.Object["metadata"].(map[string]interface{})["creationTimestamp"] = "2023-12-21T05:29:51Z"
+	object.Object["status"] = map[string]interface{}{"loadBalancer": map[string]interface{}{}}
+
+	minified, err := r.Minify(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to minify: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"annotations":{},"name":"clear-nginx-service"},"spec":{"clusterIP":"172.19.41.134","clusterIPs":["172.19.41.134"],"externalTrafficPolicy":"Cluster","internalTrafficPolicy":"Cluster","ipFamilies":["IPv4"],"ipFamilyPolicy":"SingleStack","ports":[{"name":"http","nodePort":30001,"port":80,"protocol":"TCP","targetPort":80}],"selector":{"app":"clear-nginx"},"sessionAffinity":"None","type":"NodePort"}}`
+	if got := JsonObjectToString(minified.Object); got != want {
+		t.Errorf("unexpected minified object:\n got: %v\nwant: %v", got, want)
+	}
+	if object.GetUID() == "" {
+		t.Error("object was modified")
+	}
+
+	r = newTestCreator(t, WithMinifyStrip([]string{"spec.clusterIP", "spec.clusterIPs"}))
+	if minified, err = r.Minify(ctx, object); err != nil {
+		t.Fatalf("failed to minify: %v", err)
+	}
+	if _, ok := minified.Object["status"]; !ok {
+		t.Error("expected status to be kept with a custom strip list")
+	}
+	if spec := minified.Object["spec"].(map[string]interface{}); spec["clusterIP"] != nil || spec["clusterIPs"] != nil {
+		t.Errorf("expected the cluster IPs to be stripped, got %v", spec)
+	}
+}
+
+func TestMinifyDefaults(t *testing.T) {
+	r := newWidgetCreator(t)
+	object := jsonToUnstructured(`{"apiVersion":"example.com/v1","kind":"Widget","spec":{"mode":"auto","size":1,"ports":[{"port":80,"protocol":"TCP"},{"port":53,"protocol":"UDP"}]}}`)
+
+	minified, err := r.Minify(context.Background(), object)
+	if err != nil {
+		t.Fatalf("failed to minify: %v", err)
+	}
+	want := `{"apiVersion":"example.com/v1","kind":"Widget","spec":{"ports":[{"port":80},{"port":53,"protocol":"UDP"}],"size":1}}`
+	if got := JsonObjectToString(minified.Object); got != want {
+		t.Errorf("unexpected minified object:\n got: %v\nwant: %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build offline
+
+package offline_test
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"testing"
+
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"k8s.io/kube-openapi/pkg/schemaconv"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	utils "my.domain/guestbook/pkg"
+)
+
+// kubernetesOpenAPI is the OpenAPI document of a Kubernetes apiserver, with
+// paths and descriptions stripped, so that benchmarks measure construction
+// against a realistic model set without a cluster:
+//
+//	go test -tags offline -run '^$' -bench . ./pkg/offline/
+//
+//go:embed testdata/kubernetes-openapi.json
+var kubernetesOpenAPI []byte
+
+func BenchmarkNew(b *testing.B) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := utils.NewFromOpenAPIBytes(ctx, kubernetesOpenAPI); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSchemaConvert(b *testing.B) {
+	doc, err := openapi_v2.ParseDocument(kubernetesOpenAPI)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		models, err := proto.NewOpenAPIData(doc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := schemaconv.ToSchemaWithPreserveUnknownFields(models, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// documentSource serves a parsed document, so that parsing is left out of the
+// measurement.
+type documentSource struct {
+	doc *openapi_v2.Document
+}
+
+func (s documentSource) OpenAPISchema() (*openapi_v2.Document, error) {
+	return s.doc, nil
+}
+
+func BenchmarkConcurrentSchemaConvert(b *testing.B) {
+	doc, err := openapi_v2.ParseDocument(kubernetesOpenAPI)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := utils.NewFromModelSource(ctx, documentSource{doc: doc}, utils.WithConcurrentSchemaConvert(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
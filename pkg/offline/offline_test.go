@@ -0,0 +1,79 @@
+//go:build offline
+
+// Package offline_test exercises the Creator without a cluster or a test
+// environment. Run it with:
+//
+//	go test -tags offline ./pkg/offline/
+package offline_test
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utils "my.domain/guestbook/pkg"
+)
+
+const gadgetOpenAPI = `{
+  "swagger": "2.0",
+  "info": {"title": "gadgets", "version": "v1"},
+  "paths": {},
+  "definitions": {
+    "com.example.v1.Gadget": {
+      "type": "object",
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "Gadget"}],
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "spec": {
+          "type": "object",
+          "properties": {
+            "ports": {
+              "type": "array",
+              "x-kubernetes-list-type": "map",
+              "x-kubernetes-list-map-keys": ["port"],
+              "items": {
+                "type": "object",
+                "properties": {
+                  "port": {"type": "integer"},
+                  "name": {"type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func TestOfflineConstruction(t *testing.T) {
+	ctx := context.Background()
+	r, err := utils.NewFromOpenAPIBytes(ctx, []byte(gadgetOpenAPI))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+
+	base := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Gadget",
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": int64(80)}},
+		},
+	}}
+	overlay := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Gadget",
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": int64(80), "name": "http"}},
+		},
+	}}
+	merged, err := r.MergeObjects(ctx, base, overlay)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	ports, _, _ := unstructured.NestedSlice(merged.Object, "spec", "ports")
+	if len(ports) != 1 || ports[0].(map[string]interface{})["name"] != "http" {
+		t.Errorf("expected the port to be merged by key, got %v", ports)
+	}
+}
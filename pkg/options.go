@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+)
+
+// Option configures a Creator during New.
+type Option func(*Creator)
+
+// TypeConverter converts a single OpenAPI model into a structured-merge-diff
+// type def. Returning false defers to the default schemaconv conversion for
+// that model.
+type TypeConverter func(modelName string, s proto.Schema) (mergeDiffSchema.TypeDef, bool)
+
+// withRestConfig sets the config New talks to the cluster with, for the
+// methods that rely on discovery or the dynamic client.
+func withRestConfig(restConfig *rest.Config) Option {
+	return func(r *Creator) {
+		r.restConfig = restConfig
+	}
+}
+
+// WithTypeConverter overrides how specific models are converted to
+// structured-merge-diff type defs. This allows working around known-bad CRD
+// schemas without patching the cluster. The returned type def is registered
+// under modelName regardless of its Name field. A nil converter is ignored.
+func WithTypeConverter(converter TypeConverter) Option {
+	return func(r *Creator) {
+		r.typeConverter = converter
+	}
+}
+
+// WithDeducedFallback makes ParseableType return a deduced type for GVKs that
+// are missing from the schema, like kubectl does for unknown CRDs. Extraction
+// and merging then work structurally: maps are merged granularly and lists
+// are treated as atomic.
+func WithDeducedFallback(enabled bool) Option {
+	return func(r *Creator) {
+		r.deducedFallback = enabled
+	}
+}
+
+// WithContextFields attaches the key/value pairs returned by fields to every
+// log line the Creator emits for a context, e.g. to correlate merge logs with
+// the reconcile that triggered them. fields is not called when the context
+// has no logger. A nil hook is ignored.
+func WithContextFields(fields func(ctx context.Context) []any) Option {
+	return func(r *Creator) {
+		r.contextFields = fields
+	}
+}
+
+// WithGVKExtensionKey sets the OpenAPI extension read for the GVKs of each
+// model, for documents from aggregated API servers that use a vendor key. It
+// defaults to x-kubernetes-group-version-kind.
+func WithGVKExtensionKey(key string) Option {
+	return func(r *Creator) {
+		r.gvkExtensionKey = key
+	}
+}
+
+// WithGVKAlias makes ParseableType resolve from, when the schema has no type
+// for it, to the type of to, e.g. a vendored copy of a CRD whose schema is
+// not published to its upstream equivalent. The types must be structurally
+// identical for extraction and merging to be meaningful. Aliases are not
+// followed transitively.
+func WithGVKAlias(from, to schema.GroupVersionKind) Option {
+	return func(r *Creator) {
+		if r.gvkAliases == nil {
+			r.gvkAliases = map[schema.GroupVersionKind]schema.GroupVersionKind{}
+		}
+		r.gvkAliases[from] = to
+	}
+}
+
+// WithCaseInsensitiveKinds makes ParseableType match kinds regardless of
+// case, so "service" resolves to Service, for tools taking user input. Group
+// and version still match exactly. An exact match is preferred; among kinds
+// differing only by case, the one with the smallest type name is used.
+func WithCaseInsensitiveKinds(enabled bool) Option {
+	return func(r *Creator) {
+		r.caseInsensitiveKinds = enabled
+	}
+}
+
+// WithStrictTypeMappings makes New fail when a GVK of the OpenAPI document
+// maps to a type name missing from the converted schema, instead of the
+// mismatch surfacing as an invalid ParseableType on use. It also applies to
+// schema reloads, which then keep the previous schema.
+func WithStrictTypeMappings(enabled bool) Option {
+	return func(r *Creator) {
+		r.strictTypeMappings = enabled
+	}
+}
+
+// WithConcurrentSchemaConvert looks up the models of the OpenAPI document and
+// parses their GVKs with workers goroutines, to speed up New and schema
+// reloads on clusters with many CRDs. The conversion to a structured-merge-
+// diff schema itself stays sequential. Duplicate GVKs resolve, and are
+// logged, as without the option. Values below 2 disable concurrency.
+func WithConcurrentSchemaConvert(workers int) Option {
+	return func(r *Creator) {
+		r.convertWorkers = workers
+	}
+}
+
+// WithExplainMaxDepth limits the trees rendered by Explain to depth levels
+// below the object; deeper subtrees are elided. Zero, the default, renders
+// the whole object.
+func WithExplainMaxDepth(depth int) Option {
+	return func(r *Creator) {
+		r.explainMaxDepth = depth
+	}
+}
+
+// WithExtractCache caches the results of ExtractManager and
+// ExtractManagerFull, and of the functions built on them such as
+// ExtractAsPatch, for up to size objects and managers, for controllers that
+// extract the same unchanged objects on every reconcile. Entries are keyed by
+// the object's content and resourceVersion, so any change to the object
+// misses the cache, and dropped when the schema is reloaded. Callers receive
+// copies they may modify. A size of zero or less disables the cache.
+// Extractions of several managers or of other fieldsets, such as
+// ExtractManagers or ExtractComplement, are not cached.
+func WithExtractCache(size int) Option {
+	return func(r *Creator) {
+		r.extractCache = nil
+		if size > 0 {
+			r.extractCache = newExtractCache(size)
+		}
+	}
+}
+
+// WithManagedFieldsPolicy sets what MergeObjects does with managedFields:
+// drop them (the default), preserve the base's, or recompute them for the
+// manager set with WithFieldManager.
+func WithManagedFieldsPolicy(policy ManagedFieldsPolicy) Option {
+	return func(r *Creator) {
+		r.managedFieldsPolicy = policy
+	}
+}
+
+// WithFieldManager sets the manager the Creator records its own changes
+// under, as with ManagedFieldsRecompute.
+func WithFieldManager(manager string) Option {
+	return func(r *Creator) {
+		r.fieldManager = manager
+	}
+}
+
+// WithListSort makes MergeObjects sort the list at path, e.g. "spec.ports",
+// by the values of keys, compared in turn, so merged objects serialize
+// deterministically regardless of the order of their inputs. Elements missing
+// a key sort first; ties keep their merged order. Lists without a hint keep
+// the merge order. The option may be given once per path.
+func WithListSort(path string, keys []string) Option {
+	return func(r *Creator) {
+		if r.listSorts == nil {
+			r.listSorts = map[string][]string{}
+		}
+		r.listSorts[path] = keys
+	}
+}
+
+// WithTrace reports the steps of extractions and merges to tracer as they
+// happen: the fields parsed for a manager, the list keys added to keep an
+// extraction mergeable, and the paths at which a merge failed. Every extract
+// function is traced. It is meant for interactive debugging tools; without a
+// tracer no events are built. The tracer is never called concurrently, also
+// with WithExtractConcurrency. Extractions served by WithExtractCache are not
+// traced.
+func WithTrace(tracer func(TraceEvent)) Option {
+	return func(r *Creator) {
+		r.tracer = tracer
+	}
+}
+
+// WithMinifyStrip replaces the fields Minify removes, by default status,
+// metadata.managedFields and the metadata the apiserver populates, with paths
+// in the FormatSet syntax, e.g. "metadata.labels". Fields set to their
+// default are removed regardless.
+func WithMinifyStrip(paths []string) Option {
+	return func(r *Creator) {
+		r.minifyStrip = append([]string{}, paths...)
+	}
+}
+
+// WithDropDeprecated makes ExtractNonDeprecated leave the deprecated fields it
+// reports out of the extraction, for migration tools re-applying objects
+// without them.
+func WithDropDeprecated(enabled bool) Option {
+	return func(r *Creator) {
+		r.dropDeprecated = enabled
+	}
+}
+
+// WithExtractConcurrency makes ExtractAllManagers extract the managers of an
+// object with workers goroutines, for objects with many managers. Values
+// below 2 extract them sequentially, the default.
+func WithExtractConcurrency(workers int) Option {
+	return func(r *Creator) {
+		r.extractWorkers = workers
+	}
+}
@@ -0,0 +1,512 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// AllOwnedFields returns the union of the fieldsets of every managed fields
+// entry of obj.
+func AllOwnedFields(obj *unstructured.Unstructured) (*fieldpath.Set, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	owned := fieldpath.NewSet()
+	for _, entry := range obj.GetManagedFields() {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		owned = owned.Union(set)
+	}
+	return owned, nil
+}
+
+// OwnershipDiff compares the managedFields of two revisions of an object and
+// returns, keyed by manager, the leaf fields each manager owns in newObj but
+// not in oldObj (gained) and those it owned in oldObj but no longer does
+// (lost). Entries of a manager are combined across operations and
+// subresources. Managers whose ownership did not change are left out.
+func (r *Creator) OwnershipDiff(oldObj, newObj *unstructured.Unstructured) (gained, lost map[string]*fieldpath.Set, err error) {
+	if oldObj == nil || newObj == nil {
+		return nil, nil, fmt.Errorf("old and new objects cannot be nil")
+	}
+	before, err := managerSets(oldObj)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := managerSets(newObj)
+	if err != nil {
+		return nil, nil, err
+	}
+	gained, lost = map[string]*fieldpath.Set{}, map[string]*fieldpath.Set{}
+	for manager, set := range after {
+		previous, ok := before[manager]
+		if !ok {
+			previous = fieldpath.NewSet()
+		}
+		if diff := set.Leaves().Difference(previous.Leaves()); !diff.Empty() {
+			gained[manager] = diff
+		}
+	}
+	for manager, set := range before {
+		current, ok := after[manager]
+		if !ok {
+			current = fieldpath.NewSet()
+		}
+		if diff := set.Leaves().Difference(current.Leaves()); !diff.Empty() {
+			lost[manager] = diff
+		}
+	}
+	return gained, lost, nil
+}
+
+// managerSets returns the union of the fieldsets of the managed fields
+// entries of obj, keyed by manager.
+func managerSets(obj *unstructured.Unstructured) (map[string]*fieldpath.Set, error) {
+	sets := map[string]*fieldpath.Set{}
+	for _, entry := range obj.GetManagedFields() {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := sets[entry.Manager]; ok {
+			set = existing.Union(set)
+		}
+		sets[entry.Manager] = set
+	}
+	return sets, nil
+}
+
+// ManagedFieldsEqual reports whether a and b record the same ownership: the
+// same managers own the same fields through the same operations, API versions
+// and subresources. Fieldsets are compared parsed, so the order of their JSON
+// keys does not matter, and times and the order of entries are ignored.
+// Entries whose fieldsV1 cannot be parsed make the lists unequal.
+func ManagedFieldsEqual(a, b []metav1.ManagedFieldsEntry) bool {
+	aSets, err := ownershipSets(a)
+	if err != nil {
+		return false
+	}
+	bSets, err := ownershipSets(b)
+	if err != nil || len(aSets) != len(bSets) {
+		return false
+	}
+	for owner, set := range aSets {
+		if other, ok := bSets[owner]; !ok || !set.Equals(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// ownershipSets returns the union of the fieldsets of entries, keyed by
+// everything but their time.
+func ownershipSets(entries []metav1.ManagedFieldsEntry) (map[metav1.ManagedFieldsEntry]*fieldpath.Set, error) {
+	sets := map[metav1.ManagedFieldsEntry]*fieldpath.Set{}
+	for _, entry := range entries {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		owner := metav1.ManagedFieldsEntry{
+			Manager:     entry.Manager,
+			Operation:   entry.Operation,
+			APIVersion:  entry.APIVersion,
+			Subresource: entry.Subresource,
+		}
+		if existing, ok := sets[owner]; ok {
+			set = existing.Union(set)
+		}
+		sets[owner] = set
+	}
+	return sets, nil
+}
+
+// UnownedFields returns the leaf fields set in obj that no manager owns,
+// typically values defaulted by the apiserver such as spec.clusterIP. These
+// are the fields a clean re-apply by the object's managers would not
+// reproduce. Fields never recorded in managedFields, like metadata.uid, are
+// left out. A field counts as owned when a manager owns it or one of its
+// parents as a whole.
+func (r *Creator) UnownedFields(obj *unstructured.Unstructured) (*fieldpath.Set, error) {
+	owned, err := AllOwnedFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	tv, err := r.typedObject(context.Background(), withoutManagedFields(obj))
+	if err != nil {
+		return nil, err
+	}
+	populated, err := tv.ToFieldSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute object field set: %v", err)
+	}
+
+	ownedLeaves := owned.Leaves()
+	unowned := fieldpath.NewSet()
+	populated.Leaves().Difference(strippedFields).Iterate(func(p fieldpath.Path) {
+		if owned.Has(p) {
+			return
+		}
+		for i := 1; i < len(p); i++ {
+			if ownedLeaves.Has(p[:i]) {
+				return
+			}
+		}
+		unowned.Insert(p.Copy())
+	})
+	return unowned, nil
+}
+
+// ExtractLabels returns the keys of the labels manager owns in obj, sorted.
+// Labels are owned key by key, so it answers which labels a controller
+// manages. Keys recorded in managedFields but since removed from the object
+// are included.
+func (r *Creator) ExtractLabels(obj *unstructured.Unstructured, manager string) ([]string, error) {
+	return ownedMapKeys(obj, manager, "labels")
+}
+
+// ExtractAnnotations returns the keys of the annotations manager owns in obj,
+// sorted, like ExtractLabels.
+func (r *Creator) ExtractAnnotations(obj *unstructured.Unstructured, manager string) ([]string, error) {
+	return ownedMapKeys(obj, manager, "annotations")
+}
+
+// ownedMapKeys returns the keys manager owns in the metadata map field of
+// obj, sorted.
+func ownedMapKeys(obj *unstructured.Unstructured, manager, field string) ([]string, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	set, err := managerSet(obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	descend(set, fieldpath.MakePathOrDie("metadata", field)).Iterate(func(p fieldpath.Path) {
+		if len(p) > 0 && p[0].FieldName != nil && !containsString(keys, *p[0].FieldName) {
+			keys = append(keys, *p[0].FieldName)
+		}
+	})
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// OwnershipNode is a field of an object in the tree built by OwnershipTree.
+type OwnershipNode struct {
+	// Path locates the field in the FormatPath syntax; it is empty for the
+	// object itself.
+	Path string
+	// Managers lists, sorted, the managers owning the field, a field within
+	// it, or a parent of it as a whole.
+	Managers []string
+	// Children are the fields, or list elements, within the field.
+	Children []*OwnershipNode
+}
+
+// OwnershipTree returns the fields of obj as a tree, like the object's own
+// nesting, with the managers owning each field, e.g. for a "kubectl
+// tree"-style view of ownership. Elements of associative lists are selected
+// by key. Fields shared by several managers list them all. managedFields
+// itself is left out.
+func (r *Creator) OwnershipTree(obj *unstructured.Unstructured) (*OwnershipNode, error) {
+	sets, err := managerSets(obj)
+	if err != nil {
+		return nil, err
+	}
+	tv, err := r.typedObject(context.Background(), withoutManagedFields(obj))
+	if err != nil {
+		return nil, err
+	}
+	populated, err := tv.ToFieldSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute object field set: %v", err)
+	}
+
+	managers := make([]string, 0, len(sets))
+	for manager := range sets {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+	leaves := make(map[string]*fieldpath.Set, len(sets))
+	for manager, set := range sets {
+		leaves[manager] = set.Leaves()
+	}
+	owners := func(p fieldpath.Path) []string {
+		var owners []string
+		for _, manager := range managers {
+			if ownsPath(sets[manager], leaves[manager], p) {
+				owners = append(owners, manager)
+			}
+		}
+		return owners
+	}
+
+	root := &OwnershipNode{Managers: owners(nil)}
+	nodes := map[string]*OwnershipNode{"": root}
+	populated.Iterate(func(p fieldpath.Path) {
+		parent := root
+		for i := range p {
+			key := FormatPath(p[:i+1])
+			node, ok := nodes[key]
+			if !ok {
+				node = &OwnershipNode{Path: key, Managers: owners(p[:i+1])}
+				nodes[key] = node
+				parent.Children = append(parent.Children, node)
+			}
+			parent = node
+		}
+	})
+	return root, nil
+}
+
+// ownsPath reports whether set, whose leaves are given, owns p, a field
+// within p, or a parent of p as a whole.
+func ownsPath(set, leaves *fieldpath.Set, p fieldpath.Path) bool {
+	if set.Has(p) || !descend(set, p).Empty() {
+		return true
+	}
+	for i := 1; i < len(p); i++ {
+		if leaves.Has(p[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveOwner returns the manager owning the field at path, and whether
+// other managers own it too. A manager owns the field when one of its
+// managedFields entries records it, or a parent of it as a whole.
+//
+// The managedFields already reflect the apiserver's decisions, so no
+// precedence between managers is applied. An Update that changes a field
+// takes it from its previous owners, appliers included, whose entries then no
+// longer record it; the operation of an entry grants no priority. A field
+// recorded by several managers is shared: they all set the value in effect,
+// and shared is true. The manager returned is then the co-owner that wrote
+// last, by entry time, entries without a time being the oldest and the first
+// of equal times winning; it does not own the field more than the others.
+//
+// It fails when no manager owns the field.
+func (r *Creator) EffectiveOwner(obj *unstructured.Unstructured, path string) (manager string, shared bool, err error) {
+	if obj == nil {
+		return "", false, fmt.Errorf("object cannot be nil")
+	}
+	p, err := ParsePath(path)
+	if err != nil {
+		return "", false, err
+	}
+	var winner *metav1.ManagedFieldsEntry
+	owners := map[string]bool{}
+	for _, entry := range obj.GetManagedFields() {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return "", false, err
+		}
+		if !ownsField(set, p) {
+			continue
+		}
+		owners[entry.Manager] = true
+		if winner == nil || newerEntry(entry, *winner) {
+			winner = entry.DeepCopy()
+		}
+	}
+	if winner == nil {
+		return "", false, fmt.Errorf("no manager owns %v", FormatPath(p))
+	}
+	return winner.Manager, len(owners) > 1, nil
+}
+
+// ownsField reports whether set records p, or a parent of p as a whole.
+func ownsField(set *fieldpath.Set, p fieldpath.Path) bool {
+	if set.Has(p) {
+		return true
+	}
+	for i := 1; i < len(p); i++ {
+		if set.Has(p[:i]) && descend(set, p[:i]).Empty() {
+			return true
+		}
+	}
+	return false
+}
+
+// newerEntry reports whether entry was written after current.
+func newerEntry(entry, current metav1.ManagedFieldsEntry) bool {
+	return entry.Time != nil && (current.Time == nil || entry.Time.After(current.Time.Time))
+}
+
+// TransferOwnership moves the fields at paths, and everything below them, from
+// fromManager's managedFields entries to toManager's, e.g. when a controller
+// is renamed. The object's content is not changed. The fields go to
+// toManager's entry for the main resource with the same operation as the
+// entry they leave, so applied fields stay applied; one modelled on
+// fromManager's entry is added if toManager has none. Entries of fromManager
+// left empty are dropped. At least one path is required and every path must be
+// owned by fromManager.
+func (r *Creator) TransferOwnership(ctx context.Context, obj *unstructured.Unstructured, fromManager, toManager string, paths []string) (*unstructured.Unstructured, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	if fromManager == toManager {
+		return nil, fmt.Errorf("cannot transfer ownership from %q to itself", fromManager)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no paths to transfer")
+	}
+	transferred, err := ParsePaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	owned, err := managerSet(obj, fromManager)
+	if err != nil {
+		return nil, err
+	}
+	var notOwned []string
+	transferred.Iterate(func(p fieldpath.Path) {
+		if !owned.Has(p) {
+			notOwned = append(notOwned, FormatPath(p))
+		}
+	})
+	if len(notOwned) > 0 {
+		return nil, fmt.Errorf("manager %q does not own %v", fromManager, notOwned)
+	}
+
+	// Fields move to the entry of toManager with the operation of the entry
+	// they leave, so applied fields stay applied and updated ones updated.
+	moved := fieldpath.NewSet()
+	movedByOperation := map[metav1.ManagedFieldsOperationType]*fieldpath.Set{}
+	var templates []metav1.ManagedFieldsEntry
+	entries := []metav1.ManagedFieldsEntry{}
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != fromManager {
+			entries = append(entries, entry)
+			continue
+		}
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		subtree := fieldpath.NewSet()
+		set.Iterate(func(p fieldpath.Path) {
+			for i := 1; i <= len(p); i++ {
+				if transferred.Has(p[:i]) {
+					subtree.Insert(p.Copy())
+					return
+				}
+			}
+		})
+		if subtree.Empty() {
+			entries = append(entries, entry)
+			continue
+		}
+		moved = moved.Union(subtree)
+		if byOperation, ok := movedByOperation[entry.Operation]; ok {
+			movedByOperation[entry.Operation] = byOperation.Union(subtree)
+		} else {
+			movedByOperation[entry.Operation] = subtree
+			templates = append(templates, *entry.DeepCopy())
+		}
+		remaining := set.Difference(subtree)
+		if remaining.Empty() {
+			continue
+		}
+		if entry.FieldsV1, err = fieldsV1(remaining); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	now := metav1.Now()
+	for _, template := range templates {
+		toIndex := -1
+		for i, entry := range entries {
+			if entry.Manager == toManager && entry.Subresource == "" && entry.Operation == template.Operation {
+				toIndex = i
+				break
+			}
+		}
+		if toIndex < 0 {
+			entry := template
+			entry.Manager = toManager
+			entry.Subresource = ""
+			entry.FieldsV1 = nil
+			entries = append(entries, entry)
+			toIndex = len(entries) - 1
+		}
+		toEntry := &entries[toIndex]
+		toSet, err := SetFromManagedField(*toEntry)
+		if err != nil {
+			return nil, err
+		}
+		if toEntry.FieldsV1, err = fieldsV1(toSet.Union(movedByOperation[template.Operation])); err != nil {
+			return nil, err
+		}
+		toEntry.FieldsType = "FieldsV1"
+		toEntry.Time = &now
+	}
+	r.logger(ctx).V(1).Info("Transferred field ownership", "from", fromManager, "to", toManager, "fields", FormatSet(moved.Leaves()))
+
+	result := obj.DeepCopy()
+	result.SetManagedFields(entries)
+	return result, nil
+}
+
+// OrphanPath removes path, and everything below it, from the managedFields
+// entries of every manager, leaving the field unowned so that the next apply
+// claims it without conflicts, e.g. to reset ownership after a controller
+// bug. The object's content is not changed. Entries left empty are dropped.
+// A path no manager owns leaves the managedFields as they are.
+func (r *Creator) OrphanPath(ctx context.Context, obj *unstructured.Unstructured, path string) (*unstructured.Unstructured, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("object cannot be nil")
+	}
+	orphaned, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := []metav1.ManagedFieldsEntry{}
+	for _, entry := range obj.GetManagedFields() {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			return nil, err
+		}
+		subtree := fieldpath.NewSet()
+		set.Iterate(func(p fieldpath.Path) {
+			if hasPathPrefix(p, orphaned) {
+				subtree.Insert(p.Copy())
+			}
+		})
+		if subtree.Empty() {
+			entries = append(entries, entry)
+			continue
+		}
+		r.logger(ctx).V(1).Info("Orphaned fields", "manager", entry.Manager, "fields", FormatSet(subtree.Leaves()))
+		remaining := set.Difference(subtree)
+		if remaining.Empty() {
+			continue
+		}
+		if entry.FieldsV1, err = fieldsV1(remaining); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	result := obj.DeepCopy()
+	result.SetManagedFields(entries)
+	return result, nil
+}
+
+// fieldsV1 serializes set for a managed fields entry.
+func fieldsV1(set *fieldpath.Set) (*metav1.FieldsV1, error) {
+	raw, err := set.ToJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize fieldset: %v", err)
+	}
+	return &metav1.FieldsV1{Raw: raw}, nil
+}
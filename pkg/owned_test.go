@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+func TestUnownedFields(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	unowned, err := r.UnownedFields(object)
+	if err != nil {
+		t.Fatalf("failed to compute unowned fields: %v", err)
+	}
+	for _, p := range []fieldpath.Path{
+		fieldpath.MakePathOrDie("spec", "clusterIP"),
+		fieldpath.MakePathOrDie("spec", "ipFamilyPolicy"),
+	} {
+		if !unowned.Has(p) {
+			t.Errorf("expected %v to be unowned, got %v", FormatPath(p), FormatSet(unowned))
+		}
+	}
+	for _, p := range []fieldpath.Path{
+		fieldpath.MakePathOrDie("apiVersion"),
+		fieldpath.MakePathOrDie("spec", "type"),
+		fieldpath.MakePathOrDie("spec", "selector", "app"),
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort"),
+	} {
+		if unowned.Has(p) {
+			t.Errorf("expected %v to be owned or ignored", FormatPath(p))
+		}
+	}
+}
+
+func TestTransferOwnership(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")
+
+	result, err := r.TransferOwnership(context.Background(), object, "kubectl-edit", "port-allocator", []string{FormatPath(nodePort)})
+	if err != nil {
+		t.Fatalf("failed to transfer ownership: %v", err)
+	}
+	if len(object.GetManagedFields()) != 2 {
+		t.Error("input object was modified")
+	}
+	managers := map[string]*fieldpath.Set{}
+	for _, entry := range result.GetManagedFields() {
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			t.Fatalf("failed to parse managed fields: %v", err)
+		}
+		managers[entry.Manager] = set
+	}
+	if _, ok := managers["kubectl-edit"]; ok {
+		t.Error("expected the emptied kubectl-edit entry to be dropped")
+	}
+	if set, ok := managers["port-allocator"]; !ok || !set.Has(nodePort) {
+		t.Errorf("expected port-allocator to own nodePort, got %v", managers)
+	}
+	if set := managers["kubectl-client-side-apply"]; set == nil || set.Has(nodePort) {
+		t.Error("expected kubectl-client-side-apply to be unchanged")
+	}
+
+	if _, err := r.TransferOwnership(context.Background(), object, "kubectl-edit", "port-allocator", []string{"spec.type"}); err == nil {
+		t.Error("expected an error for a path kubectl-edit does not own")
+	}
+	if _, err := r.TransferOwnership(context.Background(), object, "kubectl-edit", "port-allocator", nil); err == nil {
+		t.Error("expected an error for no paths")
+	}
+
+	// An Apply entry of the receiving manager does not take updated fields.
+	applied := object.DeepCopy()
+	applyEntry := metav1.ManagedFieldsEntry{
+		Manager:    "port-allocator",
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{}}}`)},
+	}
+	applied.SetManagedFields(append(applied.GetManagedFields(), applyEntry))
+	result, err = r.TransferOwnership(context.Background(), applied, "kubectl-edit", "port-allocator", []string{FormatPath(nodePort)})
+	if err != nil {
+		t.Fatalf("failed to transfer ownership: %v", err)
+	}
+	operations := map[metav1.ManagedFieldsOperationType]*fieldpath.Set{}
+	for _, entry := range result.GetManagedFields() {
+		if entry.Manager != "port-allocator" {
+			continue
+		}
+		set, err := SetFromManagedField(entry)
+		if err != nil {
+			t.Fatalf("failed to parse managed fields: %v", err)
+		}
+		operations[entry.Operation] = set
+	}
+	if set := operations[metav1.ManagedFieldsOperationApply]; set == nil || set.Has(nodePort) {
+		t.Errorf("expected the Apply entry of port-allocator to be unchanged, got %v", operations)
+	}
+	if set := operations[metav1.ManagedFieldsOperationUpdate]; set == nil || !set.Has(nodePort) {
+		t.Errorf("expected an Update entry of port-allocator to own nodePort, got %v", operations)
+	}
+}
+
+func TestOwnershipDiff(t *testing.T) {
+	r := newTestCreator(t)
+	before := jsonToUnstructured(issueServiceJSON)
+	after, err := r.Apply(context.Background(), before, jsonToUnstructured(issueNodePortConfig), "my-applier", true)
+	if err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort")
+
+	gained, lost, err := r.OwnershipDiff(before, after)
+	if err != nil {
+		t.Fatalf("failed to diff ownership: %v", err)
+	}
+	if len(gained) != 1 || gained["my-applier"] == nil || !gained["my-applier"].Has(nodePort) {
+		t.Errorf("expected only my-applier to gain fields, including nodePort, got %v", gained)
+	}
+	if len(lost) != 1 || lost["kubectl-edit"] == nil || !lost["kubectl-edit"].Equals(fieldpath.NewSet(nodePort)) {
+		t.Errorf("expected only kubectl-edit to lose nodePort, got %v", lost)
+	}
+
+	if gained, lost, err = r.OwnershipDiff(after, after); err != nil || len(gained) != 0 || len(lost) != 0 {
+		t.Errorf("expected no changes between identical revisions, got %v, %v, %v", gained, lost, err)
+	}
+}
+
+func TestManagedFieldsEqual(t *testing.T) {
+	entries := jsonToUnstructured(issueServiceJSON).GetManagedFields()
+	reordered := []metav1.ManagedFieldsEntry{entries[1], entries[0]}
+	reordered[1].FieldsV1 = &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:type":{},"f:sessionAffinity":{},"f:selector":{},"f:ports":{"k:{\"protocol\":\"TCP\",\"port\":80}":{"f:targetPort":{},"f:protocol":{},"f:port":{},"f:name":{},".":{}},".":{}},"f:internalTrafficPolicy":{},"f:externalTrafficPolicy":{}},"f:metadata":{"f:annotations":{"f:kubectl.kubernetes.io/last-applied-configuration":{},".":{}}}}`)}
+	reordered[1].Time = nil
+	if !ManagedFieldsEqual(entries, reordered) {
+		t.Error("expected entries with reordered keys, times and order to be equal")
+	}
+
+	changed := []metav1.ManagedFieldsEntry{entries[0], entries[1]}
+	changed[1].FieldsV1 = &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:type":{}}}`)}
+	if ManagedFieldsEqual(entries, changed) {
+		t.Error("expected entries with different fields to differ")
+	}
+	changed[1] = entries[1]
+	changed[1].Operation = metav1.ManagedFieldsOperationApply
+	if ManagedFieldsEqual(entries, changed) {
+		t.Error("expected entries with different operations to differ")
+	}
+	if ManagedFieldsEqual(entries, entries[:1]) {
+		t.Error("expected a missing entry to make the lists differ")
+	}
+}
+
+func TestOwnershipTree(t *testing.T) {
+	r := newTestCreator(t)
+	tree, err := r.OwnershipTree(jsonToUnstructured(issueServiceJSON))
+	if err != nil {
+		t.Fatalf("failed to build ownership tree: %v", err)
+	}
+
+	nodes := map[string]*OwnershipNode{}
+	var index func(n *OwnershipNode)
+	index = func(n *OwnershipNode) {
+		nodes[n.Path] = n
+		for _, child := range n.Children {
+			index(child)
+		}
+	}
+	index(tree)
+
+	both := []string{"kubectl-client-side-apply", "kubectl-edit"}
+	tests := map[string][]string{
+		"":                                    both,
+		".spec":                               both,
+		`.spec.ports[port=80,protocol="TCP"]`: both,
+		`.spec.ports[port=80,protocol="TCP"].nodePort`:   {"kubectl-edit"},
+		`.spec.ports[port=80,protocol="TCP"].targetPort`: {"kubectl-client-side-apply"},
+		".spec.clusterIP": nil,
+	}
+	for path, want := range tests {
+		node, ok := nodes[path]
+		if !ok {
+			t.Errorf("%q: missing from the tree", path)
+		} else if !reflect.DeepEqual(node.Managers, want) {
+			t.Errorf("%q: expected managers %v, got %v", path, want, node.Managers)
+		}
+	}
+	if _, ok := nodes[".metadata.managedFields"]; ok {
+		t.Error("expected managedFields to be left out")
+	}
+	ports := nodes[".spec.ports"]
+	if len(ports.Children) != 1 || len(ports.Children[0].Children) != 5 {
+		t.Errorf("expected one port with five fields, got %+v", ports.Children)
+	}
+}
+
+func TestOrphanPath(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	nodePort := fieldpath.MakePathOrDie("spec", "ports", fieldpath.KeyByFields("port", 80, "protocol", "TCP"), "nodePort")
+
+	orphaned, err := r.OrphanPath(ctx, object, `spec.ports[port=80,protocol="TCP"].nodePort`)
+	if err != nil {
+		t.Fatalf("failed to orphan path: %v", err)
+	}
+	entries := orphaned.GetManagedFields()
+	if len(entries) != 1 || entries[0].Manager != "kubectl-client-side-apply" {
+		t.Fatalf("expected the emptied kubectl-edit entry to be dropped, got %v", entries)
+	}
+	if !ManagedFieldsEqual(entries, object.GetManagedFields()[:1]) {
+		t.Error("expected the other managers' entries to be unchanged")
+	}
+	if owned, _ := AllOwnedFields(orphaned); owned.Has(nodePort) {
+		t.Error("expected nodePort to be unowned")
+	}
+	if JsonObjectToString(orphaned.Object["spec"]) != JsonObjectToString(object.Object["spec"]) {
+		t.Error("expected the object's content to be unchanged")
+	}
+
+	if orphaned, err = r.OrphanPath(ctx, object, "spec.ports"); err != nil {
+		t.Fatalf("failed to orphan path: %v", err)
+	}
+	owned, err := AllOwnedFields(orphaned)
+	if err != nil {
+		t.Fatalf("failed to read ownership: %v", err)
+	}
+	if !descend(owned, fieldpath.MakePathOrDie("spec", "ports")).Empty() || !owned.Has(fieldpath.MakePathOrDie("spec", "type")) {
+		t.Errorf("expected only the ports to be orphaned from every manager, got %v", FormatSet(owned.Leaves()))
+	}
+}
+
+func TestEffectiveOwner(t *testing.T) {
+	r := newTestCreator(t)
+	const nodePort = `spec.ports[port=80,protocol="TCP"].nodePort`
+	object := jsonToUnstructured(issueServiceJSON)
+
+	manager, shared, err := r.EffectiveOwner(object, nodePort)
+	if err != nil || manager != "kubectl-edit" || shared {
+		t.Errorf("expected kubectl-edit to own nodePort alone, got %q, %v, %v", manager, shared, err)
+	}
+
+	// Another manager that set the same nodePort earlier co-owns it,
+	// whatever its operation; kubectl-edit wrote last.
+	entries := object.GetManagedFields()
+	earlier := entries[1].DeepCopy()
+	earlier.Manager = "port-allocator"
+	earlier.Operation = metav1.ManagedFieldsOperationApply
+	earlier.Time = entries[0].Time
+	object.SetManagedFields(append(entries, *earlier))
+	manager, shared, err = r.EffectiveOwner(object, nodePort)
+	if err != nil || manager != "kubectl-edit" || !shared {
+		t.Errorf("expected nodePort to be shared, kubectl-edit writing last, got %q, %v, %v", manager, shared, err)
+	}
+
+	// An Update that changed nodePort took it from the applier, whose
+	// newer entry no longer records it.
+	applied := metav1.ManagedFieldsEntry{
+		Manager:    "port-allocator",
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: "v1",
+		Time:       &metav1.Time{Time: entries[1].Time.Add(time.Hour)},
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:type":{}}}`)},
+	}
+	object.SetManagedFields(append(entries, applied))
+	manager, shared, err = r.EffectiveOwner(object, nodePort)
+	if err != nil || manager != "kubectl-edit" || shared {
+		t.Errorf("expected the Update by kubectl-edit to own nodePort alone, got %q, %v, %v", manager, shared, err)
+	}
+
+	if _, _, err := r.EffectiveOwner(object, "spec.clusterIP"); err == nil {
+		t.Error("expected an error for an unowned field")
+	}
+	if manager, _, err := r.EffectiveOwner(object, "spec.selector.app"); err != nil || manager != "kubectl-client-side-apply" {
+		t.Errorf("expected the owner of spec.selector as a whole to own its fields, got %q, %v", manager, err)
+	}
+}
+
+func TestExtractAnnotations(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	annotations, err := r.ExtractAnnotations(object, "kubectl-client-side-apply")
+	if err != nil {
+		t.Fatalf("failed to extract annotations: %v", err)
+	}
+	if want := []string{"kubectl.kubernetes.io/last-applied-configuration"}; !reflect.DeepEqual(annotations, want) {
+		t.Errorf("expected annotations %v, got %v", want, annotations)
+	}
+	if annotations, err = r.ExtractAnnotations(object, "kubectl-edit"); err != nil || len(annotations) != 0 {
+		t.Errorf("expected kubectl-edit to own no annotations, got %v, %v", annotations, err)
+	}
+
+	object.SetLabels(map[string]string{"app": "clear-nginx", "tier": "frontend"})
+	object.SetManagedFields(append(object.GetManagedFields(), metav1.ManagedFieldsEntry{
+		Manager:    "labeler",
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:tier":{}}}}`)},
+	}))
+	labels, err := r.ExtractLabels(object, "labeler")
+	if err != nil {
+		t.Fatalf("failed to extract labels: %v", err)
+	}
+	if want := []string{"tier"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("expected labels %v, got %v", want, labels)
+	}
+	if _, err := r.ExtractLabels(object, "unknown"); err == nil {
+		t.Error("expected an error for an unknown manager")
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// CreatePatch computes a JSON merge patch turning original into modified,
+// suitable for client.Patch with types.MergePatchType. Unlike a generic JSON
+// merge patch, it compares the objects with their schema: reordering an
+// associative list or a set is not a change, so it yields no patch. Lists with
+// changed items are sent whole, as JSON merge patches require, and removed
+// fields are set to null. managedFields are ignored. An empty patch is "{}".
+func (r *Creator) CreatePatch(ctx context.Context, original, modified *unstructured.Unstructured) (data []byte, patchType types.PatchType, err error) {
+	if original == nil || modified == nil {
+		return nil, "", fmt.Errorf("original and modified objects cannot be nil")
+	}
+	originalGVK, err := ObjectGVK(original)
+	if err != nil {
+		return nil, "", fmt.Errorf("original: %v", err)
+	}
+	modifiedGVK, err := ObjectGVK(modified)
+	if err != nil {
+		return nil, "", fmt.Errorf("modified: %v", err)
+	}
+	if originalGVK != modifiedGVK {
+		return nil, "", fmt.Errorf("cannot patch %v into %v", originalGVK, modifiedGVK)
+	}
+	originalTV, err := r.typedObject(ctx, withoutManagedFields(original))
+	if err != nil {
+		return nil, "", err
+	}
+	modified = withoutManagedFields(modified)
+	modifiedTV, err := r.typedObject(ctx, modified)
+	if err != nil {
+		return nil, "", err
+	}
+	comparison, err := originalTV.Compare(modifiedTV)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to compare objects: %v", err)
+	}
+
+	patch := map[string]interface{}{}
+	set := func(p fieldpath.Path, removed bool) {
+		// JSON merge patches replace lists whole, so patch the outermost
+		// list containing a changed item.
+		for i, pe := range p {
+			if pe.FieldName == nil {
+				p, removed = p[:i], false
+				break
+			}
+		}
+		var v interface{}
+		if !removed {
+			v, _ = valueAtPath(modified.Object, p)
+		}
+		setPatchValue(patch, p, v)
+	}
+	comparison.Modified.Union(comparison.Added).Iterate(func(p fieldpath.Path) { set(p, false) })
+	comparison.Removed.Iterate(func(p fieldpath.Path) { set(p, true) })
+
+	data, err = json.Marshal(patch)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, types.MergePatchType, nil
+}
+
+// setPatchValue sets v at p in patch, which p must address by field names
+// only, creating intermediate objects as needed.
+func setPatchValue(patch map[string]interface{}, p fieldpath.Path, v interface{}) {
+	for _, pe := range p[:len(p)-1] {
+		child, ok := patch[*pe.FieldName].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			patch[*pe.FieldName] = child
+		}
+		patch = child
+	}
+	patch[*p[len(p)-1].FieldName] = v
+}
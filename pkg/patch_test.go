@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCreatePatch(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	original := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc","labels":{"app":"web","tier":"frontend"}},"spec":{"type":"NodePort","ports":[{"name":"http","port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"}]}}`)
+
+	tests := []struct {
+		name     string
+		modified string
+		want     string
+	}{{
+		name:     "reordered associative list",
+		modified: `{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc","labels":{"app":"web","tier":"frontend"}},"spec":{"type":"NodePort","ports":[{"name":"https","port":443,"protocol":"TCP"},{"name":"http","port":80,"protocol":"TCP"}]}}`,
+		want:     `{}`,
+	}, {
+		name:     "changed list item and scalar",
+		modified: `{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc","labels":{"app":"web","tier":"frontend"}},"spec":{"type":"LoadBalancer","ports":[{"name":"http","port":80,"protocol":"TCP","nodePort":30001},{"name":"https","port":443,"protocol":"TCP"}]}}`,
+		want:     `{"spec":{"ports":[{"name":"http","nodePort":30001,"port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"}],"type":"LoadBalancer"}}`,
+	}, {
+		name:     "removed field",
+		modified: `{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc","labels":{"app":"web"}},"spec":{"type":"NodePort","ports":[{"name":"http","port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"}]}}`,
+		want:     `{"metadata":{"labels":{"tier":null}}}`,
+	}}
+	for _, tc := range tests {
+		data, patchType, err := r.CreatePatch(ctx, original, jsonToUnstructured(tc.modified))
+		if err != nil {
+			t.Errorf("%v: failed to create patch: %v", tc.name, err)
+			continue
+		}
+		if patchType != types.MergePatchType {
+			t.Errorf("%v: unexpected patch type %v", tc.name, patchType)
+		}
+		if string(data) != tc.want {
+			t.Errorf("%v: unexpected patch:\n got: %s\nwant: %s", tc.name, data, tc.want)
+		}
+	}
+}
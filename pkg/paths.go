@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// FormatSet renders every path in s, in the set's order, using the syntax
+// accepted by ParsePath.
+func FormatSet(s *fieldpath.Set) []string {
+	paths := []string{}
+	if s == nil {
+		return paths
+	}
+	s.Iterate(func(p fieldpath.Path) {
+		paths = append(paths, FormatPath(p))
+	})
+	return paths
+}
+
+// FormatPath renders p like fieldpath.Path.String, e.g.
+// `.spec.ports[port=80,protocol="TCP"].nodePort`. Field names containing
+// '.', '[' or ']' are quoted so that the result can be parsed back.
+func FormatPath(p fieldpath.Path) string {
+	var b strings.Builder
+	for _, pe := range p {
+		if pe.FieldName != nil && strings.ContainsAny(*pe.FieldName, `.[]"`) {
+			b.WriteString("." + strconv.Quote(*pe.FieldName))
+			continue
+		}
+		b.WriteString(pe.String())
+	}
+	return b.String()
+}
+
+// ParsePath parses a path rendered by FormatPath. The leading '.' is optional,
+// so "spec.replicas" and ".spec.replicas" are equivalent. Bracketed elements
+// select list items by index ("[0]"), by key ("[port=80,protocol=\"TCP\"]")
+// or by value ("[=\"a\"]"); keys and values are JSON scalars.
+func ParsePath(s string) (fieldpath.Path, error) {
+	path := fieldpath.Path{}
+	rest := s
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			name, remaining, err := parseFieldName(rest[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %v", s, err)
+			}
+			path = append(path, fieldpath.PathElement{FieldName: &name})
+			rest = remaining
+		case '[':
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated '['", s)
+			}
+			pe, err := parseBracketElement(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %v", s, err)
+			}
+			path = append(path, pe)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", s, rest[0])
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("path cannot be empty")
+	}
+	return path, nil
+}
+
+// ParsePaths parses each of paths and returns them as a set.
+func ParsePaths(paths []string) (*fieldpath.Set, error) {
+	set := fieldpath.NewSet()
+	for _, p := range paths {
+		path, err := ParsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		set.Insert(path)
+	}
+	return set, nil
+}
+
+func parseFieldName(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("bad quoted field name: %v", err)
+		}
+		name, _ := strconv.Unquote(quoted)
+		return name, s[len(quoted):], nil
+	}
+	end := strings.IndexAny(s, ".[")
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("empty field name")
+	}
+	return s[:end], s[end:], nil
+}
+
+// closingBracket returns the index of the ']' closing the '[' at s[0],
+// skipping over quoted strings, or -1.
+func closingBracket(s string) int {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracketElement(s string) (fieldpath.PathElement, error) {
+	if strings.HasPrefix(s, "=") {
+		v, err := parseScalar(s[1:])
+		if err != nil {
+			return fieldpath.PathElement{}, err
+		}
+		return fieldpath.PathElement{Value: &v}, nil
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return fieldpath.PathElement{Index: &i}, nil
+	}
+
+	key := value.FieldList{}
+	for _, part := range splitOutsideQuotes(s, ',') {
+		eq := strings.Index(part, "=")
+		if eq <= 0 {
+			return fieldpath.PathElement{}, fmt.Errorf("bad key %q", part)
+		}
+		v, err := parseScalar(part[eq+1:])
+		if err != nil {
+			return fieldpath.PathElement{}, err
+		}
+		key = append(key, value.Field{Name: part[:eq], Value: v})
+	}
+	key.Sort()
+	return fieldpath.PathElement{Key: &key}, nil
+}
+
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseScalar parses a JSON scalar, keeping integers as int64 so that they
+// compare equal to the keys structured-merge-diff derives from objects.
+func parseScalar(s string) (value.Value, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("bad value %q: %v", s, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("bad value %q: trailing data", s)
+	}
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			v = i
+		} else if f, err := n.Float64(); err == nil {
+			v = f
+		}
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil, fmt.Errorf("bad value %q: must be a scalar", s)
+	}
+	return value.NewValueInterface(v), nil
+}
+
+// SetToJSONPointers renders every leaf path in s as an RFC 6901 JSON pointer,
+// e.g. "/spec/ports/0/nodePort", for use with JSON Patch tooling.
+//
+// JSON pointers address list items by position only. Paths that select items
+// by key or value, as managedFields do for associative lists and sets, are
+// resolved against obj; obj may be nil when s only uses indices. A path whose
+// item cannot be found in obj is an error.
+func SetToJSONPointers(s *fieldpath.Set, obj *unstructured.Unstructured) ([]string, error) {
+	pointers := []string{}
+	if s == nil {
+		return pointers, nil
+	}
+	var root interface{}
+	if obj != nil {
+		root = obj.Object
+	}
+	var err error
+	s.Leaves().Iterate(func(p fieldpath.Path) {
+		if err != nil {
+			return
+		}
+		var pointer string
+		if pointer, err = jsonPointer(p, root); err == nil {
+			pointers = append(pointers, pointer)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pointers, nil
+}
+
+// jsonPointer renders p as a JSON pointer, resolving key and value list
+// elements to indices in root.
+func jsonPointer(p fieldpath.Path, root interface{}) (string, error) {
+	var b strings.Builder
+	v, found := root, root != nil
+	for i, pe := range p {
+		b.WriteByte('/')
+		if pe.FieldName != nil {
+			b.WriteString(pointerEscaper.Replace(*pe.FieldName))
+		} else {
+			index := -1
+			if pe.Index != nil {
+				index = *pe.Index
+			} else if l, ok := v.([]interface{}); ok && found {
+				index = listItemIndex(l, pe)
+			}
+			if index < 0 {
+				if root == nil {
+					return "", fmt.Errorf("%v: an object is required to resolve list item positions", FormatPath(p[:i+1]))
+				}
+				return "", fmt.Errorf("%v: list item not found in object", FormatPath(p[:i+1]))
+			}
+			b.WriteString(strconv.Itoa(index))
+		}
+		if found {
+			v, found = valueAtPath(v, p[i:i+1])
+		}
+	}
+	return b.String(), nil
+}
+
+// pointerEscaper escapes a reference token as described in RFC 6901.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// pointerUnescaper reverses pointerEscaper.
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
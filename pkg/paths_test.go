@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+func TestParsePathRoundTrip(t *testing.T) {
+	set := fieldpath.NewSet(
+		fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort"),
+		fieldpath.MakePathOrDie("spec", "clusterIPs", 0),
+		fieldpath.MakePathOrDie("spec", "finalizers", value.NewValueInterface("kubernetes")),
+		fieldpath.MakePathOrDie("metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"),
+	)
+	for _, s := range FormatSet(set) {
+		p, err := ParsePath(s)
+		if err != nil {
+			t.Errorf("failed to parse %v: %v", s, err)
+			continue
+		}
+		if !set.Has(p) {
+			t.Errorf("%v did not round-trip, got %v", s, p)
+		}
+	}
+
+	if _, err := ParsePath("spec.ports[port=80abc]"); err == nil {
+		t.Error("expected an error for a malformed key value")
+	}
+}
+
+func TestSetToJSONPointers(t *testing.T) {
+	object := jsonToUnstructured(issueServiceJSON)
+	set, err := SetFromManagedField(object.GetManagedFields()[0])
+	if err != nil {
+		t.Fatalf("failed to parse managed fields: %v", err)
+	}
+
+	pointers, err := SetToJSONPointers(set, object)
+	if err != nil {
+		t.Fatalf("failed to convert set: %v", err)
+	}
+	want := map[string]bool{
+		"/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration": true,
+		"/spec/externalTrafficPolicy": true,
+		"/spec/internalTrafficPolicy": true,
+		"/spec/ports/0/name":          true,
+		"/spec/ports/0/port":          true,
+		"/spec/ports/0/protocol":      true,
+		"/spec/ports/0/targetPort":    true,
+		"/spec/selector":              true,
+		"/spec/sessionAffinity":       true,
+		"/spec/type":                  true,
+	}
+	if len(pointers) != len(want) {
+		t.Errorf("expected %d pointers, got %v", len(want), pointers)
+	}
+	for _, pointer := range pointers {
+		if !want[pointer] {
+			t.Errorf("unexpected pointer %v", pointer)
+		}
+	}
+
+	if _, err := SetToJSONPointers(set, nil); err == nil {
+		t.Error("expected an error resolving list keys without an object")
+	}
+}
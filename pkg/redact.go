@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// RedactedPlaceholder replaces redacted string values.
+const RedactedPlaceholder = "REDACTED"
+
+// ExtractRedacted extracts the fields owned by manager like ExtractManager,
+// then masks every extracted leaf under one of redactPaths (FormatSet
+// syntax), e.g. "data" for a Secret. String leaves are replaced with
+// RedactedPlaceholder; other leaves with the zero value of their kind, so the
+// result still conforms to the schema. The keys of associative list items and
+// the items of sets identify the items and, as in Minify, are kept. Every
+// redact path must match an extracted field.
+func (r *Creator) ExtractRedacted(ctx context.Context, obj *unstructured.Unstructured, manager string, redactPaths []string) (*typed.TypedValue, error) {
+	redact := make([]fieldpath.Path, 0, len(redactPaths))
+	for _, p := range redactPaths {
+		path, err := ParsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		redact = append(redact, path)
+	}
+
+	extracted, err := r.ExtractManager(ctx, obj, manager)
+	if err != nil {
+		return nil, err
+	}
+	u, err := ToUnstructured(extracted)
+	if err != nil {
+		return nil, err
+	}
+	// Items of associative lists and sets are addressed by their keys and
+	// values, which redaction may change, so the items are resolved to
+	// their position before any is modified.
+	var targets []fieldpath.Path
+	var values []interface{}
+	matched := make([]bool, len(redact))
+	err = WalkTyped(extracted, func(path fieldpath.Path, v value.Value) error {
+		for i, prefix := range redact {
+			if hasPathPrefix(path, prefix) {
+				matched[i] = true
+				if isListKey(path) {
+					break
+				}
+				target, ok := positionalPath(u.Object, path)
+				if !ok {
+					return fmt.Errorf("%v: cannot redact, field not found", FormatPath(path))
+				}
+				targets = append(targets, target)
+				values = append(values, redactedValue(v))
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var unmatched []string
+	for i, ok := range matched {
+		if !ok {
+			unmatched = append(unmatched, redactPaths[i])
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no extracted field matches %v", unmatched)
+	}
+	for i, target := range targets {
+		if !setValueAtPath(u.Object, target, values[i]) {
+			return nil, fmt.Errorf("%v: cannot redact, field not found", FormatPath(target))
+		}
+	}
+	return typed.AsTyped(value.NewValueInterface(u.Object), extracted.Schema(), extracted.TypeRef())
+}
+
+// isListKey reports whether path leads to a value identifying a list item:
+// a key field of an associative list item, or an item of a set.
+func isListKey(path fieldpath.Path) bool {
+	if len(path) == 0 {
+		return false
+	}
+	last := path[len(path)-1]
+	if last.Value != nil {
+		return true
+	}
+	if len(path) < 2 || last.FieldName == nil || path[len(path)-2].Key == nil {
+		return false
+	}
+	for _, key := range *path[len(path)-2].Key {
+		if key.Name == *last.FieldName {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedValue returns the value replacing v in a redacted extraction.
+func redactedValue(v value.Value) interface{} {
+	switch {
+	case v == nil || v.IsNull():
+		return nil
+	case v.IsString():
+		return RedactedPlaceholder
+	case v.IsInt():
+		return int64(0)
+	case v.IsFloat():
+		return float64(0)
+	case v.IsBool():
+		return false
+	case v.IsList():
+		return []interface{}{}
+	default:
+		return map[string]interface{}{}
+	}
+}
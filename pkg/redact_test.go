@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestExtractRedacted(t *testing.T) {
+	r := newTestCreator(t)
+	secret := jsonToUnstructured(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds","namespace":"default","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:data":{".":{},"f:password":{},"f:username":{}},"f:type":{}},"manager":"my-manager","operation":"Apply"}]},"data":{"password":"c2VjcmV0","username":"YWRtaW4="},"type":"Opaque"}`)
+
+	extracted, err := r.ExtractRedacted(context.Background(), secret, "my-manager", []string{"data"})
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	want := jsonToInterface(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds","namespace":"default"},"data":{"password":"REDACTED","username":"REDACTED"},"type":"Opaque"}`)
+	if got := extracted.AsValue().Unstructured(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected extraction:\n got: %v\nwant: %v", got, want)
+	}
+	if data, _, _ := unstructured.NestedString(secret.Object, "data", "password"); data != "c2VjcmV0" {
+		t.Errorf("input object must not be modified, got password %q", data)
+	}
+}
+
+func TestExtractRedactedAssociativeList(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	extracted, err := r.ExtractRedacted(context.Background(), object, "kubectl-client-side-apply", []string{"spec.ports"})
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	ports, _, _ := unstructured.NestedSlice(extracted.AsValue().Unstructured().(map[string]interface{}), "spec", "ports")
+	want := `[{"name":"REDACTED","port":80,"protocol":"TCP","targetPort":0}]`
+	if JsonObjectToString(ports) != want {
+		t.Errorf("expected every member of the port but its keys to be redacted, got %v", ports)
+	}
+
+	twoPorts := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"default","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:ports":{"k:{\"port\":80,\"protocol\":\"TCP\"}":{".":{},"f:name":{},"f:port":{},"f:protocol":{}},"k:{\"port\":443,\"protocol\":\"TCP\"}":{".":{},"f:name":{},"f:port":{},"f:protocol":{}}}}},"manager":"my-manager","operation":"Apply"}]},"spec":{"ports":[{"name":"http","port":80,"protocol":"TCP"},{"name":"https","port":443,"protocol":"TCP"}]}}`)
+	extracted, err = r.ExtractRedacted(context.Background(), twoPorts, "my-manager", []string{"spec.ports"})
+	if err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	ports, _, _ = unstructured.NestedSlice(extracted.AsValue().Unstructured().(map[string]interface{}), "spec", "ports")
+	want = `[{"name":"REDACTED","port":80,"protocol":"TCP"},{"name":"REDACTED","port":443,"protocol":"TCP"}]`
+	if JsonObjectToString(ports) != want {
+		t.Errorf("expected both ports to keep their keys, got %v", ports)
+	}
+}
+
+func TestExtractRedactedUnmatchedPath(t *testing.T) {
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	_, err := r.ExtractRedacted(context.Background(), object, "kubectl-client-side-apply", []string{"spec.ports", "spec.clusterIP"})
+	if err == nil || !strings.Contains(err.Error(), "spec.clusterIP") {
+		t.Errorf("expected an error naming the unmatched path, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+// ResourceScope reports whether resources of gvk are namespaced, as served by
+// the cluster. Tooling that builds apply configurations can use it to decide
+// whether to set a namespace. Discovery results are cached for the lifetime
+// of the Creator.
+func (r *Creator) ResourceScope(gvk schema.GroupVersionKind) (namespaced bool, err error) {
+	dc, err := r.discoveryClient()
+	if err != nil {
+		return false, err
+	}
+	resources, err := dc.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		return false, fmt.Errorf("failed to discover resources for %v: %v", gvk.GroupVersion(), err)
+	}
+	for _, resource := range resources.APIResources {
+		// Subresources such as "services/status" share the kind of their
+		// parent resource.
+		if resource.Kind == gvk.Kind && !isSubresource(resource.Name) {
+			return resource.Namespaced, nil
+		}
+	}
+	return false, fmt.Errorf("no resource found for GVK %v", gvk)
+}
+
+// discoveryClient returns the Creator's cached discovery client, creating it
+// on first use.
+func (r *Creator) discoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	r.discoveryOnce.Do(func() {
+		if r.restConfig == nil {
+			r.discoveryErr = fmt.Errorf("discovery requires a rest config")
+			return
+		}
+		dc, err := discovery.NewDiscoveryClientForConfig(r.restConfig)
+		if err != nil {
+			r.discoveryErr = fmt.Errorf("failed to create discovery client: %v", err)
+			return
+		}
+		r.discovery = memory.NewMemCacheClient(dc)
+	})
+	return r.discovery, r.discoveryErr
+}
+
+// isSubresource reports whether the discovered resource name names a
+// subresource, e.g. "deployments/scale".
+func isSubresource(name string) bool {
+	return strings.Contains(name, "/")
+}
+
+// ParseableTypeByKind resolves the type for kind in group when the version is
+// not known, e.g. for CLIs accepting a bare "Service". Among the versions the
+// schema defines for the kind, the group's preferred version is chosen;
+// otherwise the single served one. It returns the GVK it used, and an error
+// when no version or several equally preferred versions qualify.
+func (r *Creator) ParseableTypeByKind(ctx context.Context, group, kind string) (*typed.ParseableType, schema.GroupVersionKind, error) {
+	_, gvkToTypeNameMap := r.types()
+	candidates := map[string]schema.GroupVersionKind{}
+	for gvk := range gvkToTypeNameMap {
+		if gvk.Group == group && gvk.Kind == kind {
+			candidates[gvk.Version] = gvk
+		}
+	}
+	gk := schema.GroupKind{Group: group, Kind: kind}
+	if len(candidates) == 0 {
+		return nil, schema.GroupVersionKind{}, fmt.Errorf("no schema found for %v", gk)
+	}
+
+	gvk, err := r.preferredVersion(gk, candidates)
+	if err != nil {
+		return nil, schema.GroupVersionKind{}, err
+	}
+	return r.ParseableType(ctx, gvk), gvk, nil
+}
+
+// preferredVersion picks the GVK of candidates, keyed by version, that
+// discovery prefers for the group of gk.
+func (r *Creator) preferredVersion(gk schema.GroupKind, candidates map[string]schema.GroupVersionKind) (schema.GroupVersionKind, error) {
+	if len(candidates) == 1 {
+		for _, gvk := range candidates {
+			return gvk, nil
+		}
+	}
+	g, err := r.serverGroup(gk.Group)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	if gvk, ok := candidates[g.PreferredVersion.Version]; ok {
+		return gvk, nil
+	}
+	var served []schema.GroupVersionKind
+	for _, v := range g.Versions {
+		if gvk, ok := candidates[v.Version]; ok {
+			served = append(served, gvk)
+		}
+	}
+	switch len(served) {
+	case 0:
+		return schema.GroupVersionKind{}, fmt.Errorf("no served version found for %v", gk)
+	case 1:
+		return served[0], nil
+	default:
+		return schema.GroupVersionKind{}, fmt.Errorf("%v is served in several versions and none is preferred: %v", gk, served)
+	}
+}
+
+// ServedVersions returns the versions the cluster serves for group, the
+// preferred one first and the others in discovery order. The core group is
+// "". Discovery results are cached for the lifetime of the Creator.
+func (r *Creator) ServedVersions(group string) ([]string, error) {
+	g, err := r.serverGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	if preferred := g.PreferredVersion.Version; preferred != "" {
+		versions = append(versions, preferred)
+	}
+	for _, v := range g.Versions {
+		if v.Version != g.PreferredVersion.Version {
+			versions = append(versions, v.Version)
+		}
+	}
+	return versions, nil
+}
+
+// serverGroup returns the discovered API group named group.
+func (r *Creator) serverGroup(group string) (metav1.APIGroup, error) {
+	dc, err := r.discoveryClient()
+	if err != nil {
+		return metav1.APIGroup{}, err
+	}
+	groups, err := dc.ServerGroups()
+	if err != nil {
+		return metav1.APIGroup{}, fmt.Errorf("failed to discover API groups: %v", err)
+	}
+	for _, g := range groups.Groups {
+		if g.Name == group {
+			return g, nil
+		}
+	}
+	return metav1.APIGroup{}, fmt.Errorf("API group %q not found", group)
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResourceScope(t *testing.T) {
+	r := newTestCreator(t)
+
+	tests := map[schema.GroupVersionKind]bool{
+		serviceGVK:                    true,
+		{Version: "v1", Kind: "Node"}: false,
+	}
+	for gvk, want := range tests {
+		namespaced, err := r.ResourceScope(gvk)
+		if err != nil {
+			t.Errorf("%v: %v", gvk, err)
+			continue
+		}
+		if namespaced != want {
+			t.Errorf("%v: expected namespaced %v, got %v", gvk, want, namespaced)
+		}
+	}
+
+	if _, err := r.ResourceScope(schema.GroupVersionKind{Version: "v1", Kind: "Widget"}); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestParseableTypeByKind(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+
+	tests := map[schema.GroupKind]schema.GroupVersionKind{
+		{Kind: "Service"}:                   serviceGVK,
+		{Group: "apps", Kind: "Deployment"}: {Group: "apps", Version: "v1", Kind: "Deployment"},
+	}
+	for gk, want := range tests {
+		objectType, gvk, err := r.ParseableTypeByKind(ctx, gk.Group, gk.Kind)
+		if err != nil {
+			t.Errorf("%v: %v", gk, err)
+			continue
+		}
+		if gvk != want {
+			t.Errorf("%v: expected %v, got %v", gk, want, gvk)
+		}
+		if objectType == nil || !objectType.IsValid() {
+			t.Errorf("%v: expected a valid type", gk)
+		}
+	}
+
+	if _, _, err := r.ParseableTypeByKind(ctx, "", "Widget"); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestServedVersions(t *testing.T) {
+	r := newTestCreator(t)
+
+	versions, err := r.ServedVersions("apps")
+	if err != nil {
+		t.Fatalf("failed to get served versions: %v", err)
+	}
+	if len(versions) == 0 || versions[0] != "v1" {
+		t.Errorf("expected v1 to be the preferred apps version, got %v", versions)
+	}
+
+	if _, err := r.ServedVersions("widgets.example.com"); err == nil {
+		t.Error("expected an error for an unknown group")
+	}
+}
@@ -0,0 +1,384 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+)
+
+// FieldType returns the schema atom found at path in the type for gvk, e.g.
+// a numeric scalar for "spec.replicas" or a list for "spec.ports". The path
+// uses the FormatSet syntax; list elements may be selected by index, key or
+// value, or the list atom itself may be requested by stopping at the list.
+func (r *Creator) FieldType(gvk schema.GroupVersionKind, path string) (mergeDiffSchema.Atom, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return mergeDiffSchema.Atom{}, err
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return mergeDiffSchema.Atom{}, err
+	}
+	return atomAtPath(s, atom, p)
+}
+
+// SchemaAtPointer returns the schema atom found at the RFC 6901 JSON pointer
+// in the type for gvk, e.g. "/spec/ports/0/nodePort". Tokens into lists must
+// be indices or "-" (the end of the list); either selects the list's element
+// type. The empty pointer selects the type itself.
+func (r *Creator) SchemaAtPointer(gvk schema.GroupVersionKind, pointer string) (mergeDiffSchema.Atom, error) {
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return mergeDiffSchema.Atom{}, fmt.Errorf("invalid JSON pointer %q: must start with '/'", pointer)
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return mergeDiffSchema.Atom{}, err
+	}
+	if pointer == "" {
+		return atom, nil
+	}
+	for i, token := range strings.Split(pointer[1:], "/") {
+		token = pointerUnescaper.Replace(token)
+		var pe fieldpath.PathElement
+		if atom.List != nil {
+			index, err := strconv.Atoi(token)
+			if token == "-" {
+				index, err = 0, nil
+			}
+			if err != nil || index < 0 {
+				return mergeDiffSchema.Atom{}, fmt.Errorf("%v: token %d: %q is not a list index", pointer, i, token)
+			}
+			pe = fieldpath.PathElement{Index: &index}
+		} else {
+			pe = fieldpath.PathElement{FieldName: &token}
+		}
+		tr, err := childTypeRef(atom, pe)
+		if err != nil {
+			return mergeDiffSchema.Atom{}, fmt.Errorf("%v: token %d: %v", pointer, i, err)
+		}
+		next, ok := s.Resolve(tr)
+		if !ok {
+			return mergeDiffSchema.Atom{}, fmt.Errorf("%v: token %d: unresolvable type reference", pointer, i)
+		}
+		atom = next
+	}
+	return atom, nil
+}
+
+// rootAtom resolves the named type for gvk in the current schema, which it
+// returns as well.
+func (r *Creator) rootAtom(gvk schema.GroupVersionKind) (*mergeDiffSchema.Schema, mergeDiffSchema.Atom, error) {
+	s, gvkToTypeNameMap := r.types()
+	typeName, ok := gvkToTypeNameMap[gvk]
+	if !ok {
+		return nil, mergeDiffSchema.Atom{}, fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	atom, ok := s.Resolve(mergeDiffSchema.TypeRef{NamedType: &typeName})
+	if !ok {
+		return nil, mergeDiffSchema.Atom{}, fmt.Errorf("type %v for GVK %v not found in schema", typeName, gvk)
+	}
+	return s, atom, nil
+}
+
+// atomAtPath walks p down from atom in s, following struct fields, map values
+// and list elements.
+func atomAtPath(s *mergeDiffSchema.Schema, atom mergeDiffSchema.Atom, p fieldpath.Path) (mergeDiffSchema.Atom, error) {
+	for i, pe := range p {
+		tr, err := childTypeRef(atom, pe)
+		if err != nil {
+			return mergeDiffSchema.Atom{}, fmt.Errorf("%v: %v", FormatPath(p[:i+1]), err)
+		}
+		next, ok := s.Resolve(tr)
+		if !ok {
+			return mergeDiffSchema.Atom{}, fmt.Errorf("%v: unresolvable type reference", FormatPath(p[:i+1]))
+		}
+		atom = next
+	}
+	return atom, nil
+}
+
+// childTypeRef returns the type reference of the child of atom selected by
+// pe.
+func childTypeRef(atom mergeDiffSchema.Atom, pe fieldpath.PathElement) (mergeDiffSchema.TypeRef, error) {
+	if pe.FieldName != nil {
+		if atom.Map == nil {
+			return mergeDiffSchema.TypeRef{}, fmt.Errorf("not a map")
+		}
+		if field, ok := atom.Map.FindField(*pe.FieldName); ok {
+			return field.Type, nil
+		}
+		if atom.Map.ElementType.NamedType != nil || atom.Map.ElementType.Inlined != (mergeDiffSchema.Atom{}) {
+			return atom.Map.ElementType, nil
+		}
+		return mergeDiffSchema.TypeRef{}, fmt.Errorf("unknown field")
+	}
+	if atom.List == nil {
+		return mergeDiffSchema.TypeRef{}, fmt.Errorf("not a list")
+	}
+	return atom.List.ElementType, nil
+}
+
+// deducedTypeName is the type schemaconv gives to the values of maps marked
+// with x-kubernetes-preserve-unknown-fields.
+const deducedTypeName = "__untyped_deduced_"
+
+// untypedScalar is the scalar type schemaconv uses for values of any type.
+const untypedScalar = mergeDiffSchema.Scalar("untyped")
+
+// IsPreserveUnknown reports whether path in the type for gvk lies within an
+// x-kubernetes-preserve-unknown-fields region, i.e. whether the object at
+// path or one of its ancestors keeps fields its schema does not declare.
+// Free-form objects (type object without properties) count as such regions.
+// Fields outside them are dropped by the apiserver and by merges.
+func (r *Creator) IsPreserveUnknown(gvk schema.GroupVersionKind, path string) (bool, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return false, err
+	}
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return false, err
+	}
+	preserved := preservesUnknownFields(atom)
+	for i, pe := range p {
+		tr, err := childTypeRef(atom, pe)
+		if err != nil {
+			return false, fmt.Errorf("%v: %v", FormatPath(p[:i+1]), err)
+		}
+		next, ok := s.Resolve(tr)
+		if !ok {
+			return false, fmt.Errorf("%v: unresolvable type reference", FormatPath(p[:i+1]))
+		}
+		atom = next
+		preserved = preserved || preservesUnknownFields(atom)
+	}
+	return preserved, nil
+}
+
+// preservesUnknownFields reports whether atom is a map that keeps undeclared
+// fields: its values are of the deduced type, either by reference or, for
+// free-form objects, inlined.
+func preservesUnknownFields(atom mergeDiffSchema.Atom) bool {
+	if atom.Map == nil {
+		return false
+	}
+	elem := atom.Map.ElementType
+	if elem.NamedType != nil {
+		return *elem.NamedType == deducedTypeName
+	}
+	inlined := elem.Inlined
+	return inlined.Scalar != nil && *inlined.Scalar == untypedScalar && inlined.List != nil && inlined.Map != nil
+}
+
+// NamedTypes returns the names of every type in the converted schema, sorted.
+// It helps debug ParseableType misses where a GVK maps to a type name the
+// schema lacks.
+func (r *Creator) NamedTypes() []string {
+	s, _ := r.types()
+	names := make([]string, 0, len(s.Types))
+	for _, typeDef := range s.Types {
+		names = append(names, typeDef.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasNamedType reports whether the converted schema defines the type name.
+func (r *Creator) HasNamedType(name string) bool {
+	s, _ := r.types()
+	_, ok := s.FindNamedType(name)
+	return ok
+}
+
+// ApplyConfigTypeName returns the name client-go's applyconfiguration-gen
+// gives the apply configuration of gvk, e.g. "ServiceApplyConfiguration" for
+// v1 Service. The group and version only pick the package the type lives in,
+// such as k8s.io/client-go/applyconfigurations/core/v1. It fails for GVKs the
+// schema does not know.
+func (r *Creator) ApplyConfigTypeName(gvk schema.GroupVersionKind) (string, error) {
+	_, gvkToTypeNameMap := r.types()
+	if _, ok := gvkToTypeNameMap[gvk]; !ok {
+		return "", fmt.Errorf("no schema found for GVK %v", gvk)
+	}
+	return gvk.Kind + "ApplyConfiguration", nil
+}
+
+// DanglingMappings returns the GVKs mapped to a type name the converted
+// schema does not define, with that name. ParseableType returns an invalid
+// type for them. A healthy Creator has none; see WithStrictTypeMappings to
+// fail New instead.
+func (r *Creator) DanglingMappings() map[schema.GroupVersionKind]string {
+	s, gvkToTypeNameMap := r.types()
+	return danglingMappings(s, gvkToTypeNameMap)
+}
+
+// danglingMappings returns the entries of gvkToTypeNameMap naming types s
+// lacks.
+func danglingMappings(s *mergeDiffSchema.Schema, gvkToTypeNameMap map[schema.GroupVersionKind]string) map[schema.GroupVersionKind]string {
+	dangling := map[schema.GroupVersionKind]string{}
+	for gvk, typeName := range gvkToTypeNameMap {
+		if _, ok := s.FindNamedType(typeName); !ok {
+			dangling[gvk] = typeName
+		}
+	}
+	return dangling
+}
+
+// SchemaDigest returns a stable sha256 digest of the converted schema. Two
+// Creators built from the same OpenAPI document produce the same digest, so
+// it can be used to compare clusters or invalidate cached schemas. It is empty
+// if the schema cannot be serialized.
+func (r *Creator) SchemaDigest() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.digestOnce.Do(func() {
+		types := append([]mergeDiffSchema.TypeDef(nil), r.schema.Types...)
+		sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+		// The schema types only carry yaml.v2 tags, inlined atoms included,
+		// so they are encoded with yaml.v2 rather than through JSON.
+		b, err := yaml.Marshal(types)
+		if err != nil {
+			return
+		}
+		sum := sha256.Sum256(b)
+		r.digest = hex.EncodeToString(sum[:])
+	})
+	return r.digest
+}
+
+// ListRelationships describes every list in the type for gvk, keyed by its
+// path. Paths use the FormatPath syntax, with "[*]" standing for any element
+// of an enclosing list, e.g. ".spec.containers[*].ports". Descriptions are
+// "atomic", "set" or "associative" followed by the key fields, e.g.
+// "associative(containerPort,protocol)". Recursive types are followed once.
+func (r *Creator) ListRelationships(gvk schema.GroupVersionKind) (map[string]string, error) {
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return nil, err
+	}
+	relationships := map[string]string{}
+	collectListRelationships(s, atom, "", map[string]bool{}, relationships)
+	return relationships, nil
+}
+
+// collectListRelationships records the lists reachable from atom, found at
+// path, into out. visiting holds the named types being expanded.
+func collectListRelationships(s *mergeDiffSchema.Schema, atom mergeDiffSchema.Atom, path string, visiting map[string]bool, out map[string]string) {
+	follow := func(tr mergeDiffSchema.TypeRef, path string) {
+		if tr.NamedType != nil {
+			if visiting[*tr.NamedType] {
+				return
+			}
+			visiting[*tr.NamedType] = true
+			defer delete(visiting, *tr.NamedType)
+		}
+		if next, ok := s.Resolve(tr); ok {
+			collectListRelationships(s, next, path, visiting, out)
+		}
+	}
+	if atom.List != nil {
+		out[path] = listRelationship(atom.List)
+		follow(atom.List.ElementType, path+"[*]")
+	}
+	if atom.Map != nil {
+		for _, field := range atom.Map.Fields {
+			name := field.Name
+			follow(field.Type, path+FormatPath(fieldpath.Path{{FieldName: &name}}))
+		}
+	}
+}
+
+// listRelationship describes how the items of l are merged.
+func listRelationship(l *mergeDiffSchema.List) string {
+	switch {
+	case l.ElementRelationship == mergeDiffSchema.Atomic:
+		return "atomic"
+	case len(l.Keys) == 0:
+		return "set"
+	default:
+		return fmt.Sprintf("associative(%v)", strings.Join(l.Keys, ","))
+	}
+}
+
+// ValidateListKeys checks that the keys of every associative list in the type
+// for gvk are scalar fields of the list's element type. Merges assume they
+// are; a schema declaring a missing or composite key otherwise only fails
+// once such a list is merged. The error names every offending list.
+func (r *Creator) ValidateListKeys(gvk schema.GroupVersionKind) error {
+	s, atom, err := r.rootAtom(gvk)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	collectListKeyProblems(s, atom, "", map[string]bool{}, &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid list keys in %v: %v", gvk, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// collectListKeyProblems appends a description of each associative list
+// reachable from atom, found at path, whose keys are not scalar fields of its
+// elements. visiting holds the named types being expanded.
+func collectListKeyProblems(s *mergeDiffSchema.Schema, atom mergeDiffSchema.Atom, path string, visiting map[string]bool, problems *[]string) {
+	follow := func(tr mergeDiffSchema.TypeRef, path string) {
+		if tr.NamedType != nil {
+			if visiting[*tr.NamedType] {
+				return
+			}
+			visiting[*tr.NamedType] = true
+			defer delete(visiting, *tr.NamedType)
+		}
+		if next, ok := s.Resolve(tr); ok {
+			collectListKeyProblems(s, next, path, visiting, problems)
+		}
+	}
+	if atom.List != nil {
+		if atom.List.ElementRelationship == mergeDiffSchema.Associative && len(atom.List.Keys) > 0 {
+			for _, key := range atom.List.Keys {
+				if problem := listKeyProblem(s, atom.List.ElementType, key); problem != "" {
+					*problems = append(*problems, fmt.Sprintf("%v: key %q %v", path, key, problem))
+				}
+			}
+		}
+		follow(atom.List.ElementType, path+"[*]")
+	}
+	if atom.Map != nil {
+		for _, field := range atom.Map.Fields {
+			name := field.Name
+			follow(field.Type, path+FormatPath(fieldpath.Path{{FieldName: &name}}))
+		}
+	}
+}
+
+// listKeyProblem describes why key is not a scalar field of the element type
+// elem, or returns "" if it is.
+func listKeyProblem(s *mergeDiffSchema.Schema, elem mergeDiffSchema.TypeRef, key string) string {
+	elemAtom, ok := s.Resolve(elem)
+	if !ok {
+		return "has an unresolvable element type"
+	}
+	if elemAtom.Map == nil {
+		return "is declared on elements that are not maps"
+	}
+	field, ok := elemAtom.Map.FindField(key)
+	if !ok {
+		return "is not a field of the elements"
+	}
+	keyAtom, ok := s.Resolve(field.Type)
+	if !ok {
+		return "has an unresolvable type"
+	}
+	if keyAtom.Scalar == nil || keyAtom.Map != nil || keyAtom.List != nil {
+		return "is not a scalar"
+	}
+	return ""
+}
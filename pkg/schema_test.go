@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+)
+
+var serviceGVK = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"}
+
+func TestFieldType(t *testing.T) {
+	r := newTestCreator(t)
+	deploymentGVK := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	atom, err := r.FieldType(deploymentGVK, "spec.replicas")
+	if err != nil {
+		t.Fatalf("failed to get field type: %v", err)
+	}
+	if atom.Scalar == nil || *atom.Scalar != mergeDiffSchema.Numeric {
+		t.Errorf("expected spec.replicas to be numeric, got %+v", atom)
+	}
+
+	atom, err = r.FieldType(serviceGVK, ".spec.ports")
+	if err != nil {
+		t.Fatalf("failed to get field type: %v", err)
+	}
+	if atom.List == nil || atom.List.ElementRelationship != mergeDiffSchema.Associative {
+		t.Errorf("expected spec.ports to be an associative list, got %+v", atom)
+	}
+
+	for path, want := range map[string]mergeDiffSchema.Scalar{
+		`.spec.ports[port=80,protocol="TCP"].nodePort`: mergeDiffSchema.Numeric,
+		`.spec.selector.app`:                           mergeDiffSchema.String,
+	} {
+		atom, err := r.FieldType(serviceGVK, path)
+		if err != nil {
+			t.Errorf("failed to get field type of %v: %v", path, err)
+			continue
+		}
+		if atom.Scalar == nil || *atom.Scalar != want {
+			t.Errorf("expected %v to be %v, got %+v", path, want, atom)
+		}
+	}
+
+	for _, path := range []string{"spec.doesNotExist", "spec.type.nested", "spec.ports.name", "spec[0"} {
+		if _, err := r.FieldType(serviceGVK, path); err == nil {
+			t.Errorf("expected an error for %v", path)
+		}
+	}
+}
+
+func TestSchemaDigest(t *testing.T) {
+	first, second := newTestCreator(t), newTestCreator(t)
+	if first.SchemaDigest() == "" {
+		t.Fatal("expected a non-empty digest")
+	}
+	if first.SchemaDigest() != second.SchemaDigest() {
+		t.Errorf("expected identical digests, got %v and %v", first.SchemaDigest(), second.SchemaDigest())
+	}
+
+	scalar := mergeDiffSchema.String
+	converted := newTestCreator(t, WithTypeConverter(func(modelName string, _ proto.Schema) (mergeDiffSchema.TypeDef, bool) {
+		return mergeDiffSchema.TypeDef{Atom: mergeDiffSchema.Atom{Scalar: &scalar}}, modelName == "io.k8s.api.core.v1.ServicePort"
+	}))
+	if converted.SchemaDigest() == first.SchemaDigest() {
+		t.Error("expected a different digest for a different schema")
+	}
+}
+
+// widgetOpenAPI describes a custom resource whose spec.config preserves
+// unknown fields and whose spec.mode and port protocols have defaults.
+const widgetOpenAPI = `{
+  "swagger": "2.0",
+  "info": {"title": "widgets", "version": "v1"},
+  "paths": {},
+  "definitions": {
+    "com.example.v1.Widget": {
+      "type": "object",
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "Widget"}],
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "spec": {
+          "type": "object",
+          "properties": {
+            "size": {"type": "integer"},
+            "mode": {"type": "string", "default": "auto"},
+            "ports": {
+              "type": "array",
+              "items": {
+                "type": "object",
+                "properties": {
+                  "port": {"type": "integer"},
+                  "protocol": {"type": "string", "default": "TCP"}
+                }
+              }
+            },
+            "config": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+          }
+        }
+      }
+    }
+  }
+}`
+
+var widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+// newWidgetCreator builds a Creator from widgetOpenAPI without a cluster.
+func newWidgetCreator(t *testing.T, opts ...Option) *Creator {
+	t.Helper()
+	r, err := NewFromOpenAPIBytes(context.Background(), []byte(widgetOpenAPI), opts...)
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+	return r
+}
+
+func TestIsPreserveUnknown(t *testing.T) {
+	r := newWidgetCreator(t)
+
+	tests := map[string]bool{
+		"spec.size":             false,
+		"spec.config":           true,
+		"spec.config.arbitrary": true,
+		"spec.config.a.b.c":     true,
+	}
+	for path, want := range tests {
+		got, err := r.IsPreserveUnknown(widgetGVK, path)
+		if err != nil {
+			t.Errorf("%v: %v", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%v: expected %v, got %v", path, want, got)
+		}
+	}
+
+	if _, err := r.IsPreserveUnknown(widgetGVK, "spec.unknown"); err == nil {
+		t.Error("expected an error for an undeclared field outside the region")
+	}
+}
+
+func TestListRelationships(t *testing.T) {
+	r := newTestCreator(t)
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+
+	relationships, err := r.ListRelationships(podGVK)
+	if err != nil {
+		t.Fatalf("failed to list relationships: %v", err)
+	}
+	want := map[string]string{
+		".metadata.finalizers":      "set",
+		".metadata.ownerReferences": "associative(uid)",
+		".spec.containers":          "associative(name)",
+		".spec.containers[*].args":  "atomic",
+		".spec.containers[*].ports": "associative(containerPort,protocol)",
+	}
+	for path, relationship := range want {
+		if got := relationships[path]; got != relationship {
+			t.Errorf("%v: expected %q, got %q", path, relationship, got)
+		}
+	}
+	if got, ok := relationships[".spec.containers[*].env[*].name"]; ok {
+		t.Errorf("expected only lists to be reported, got %q for a string field", got)
+	}
+}
+
+func TestNamedTypes(t *testing.T) {
+	r := newTestCreator(t)
+	const serviceType = "io.k8s.api.core.v1.Service"
+
+	names := r.NamedTypes()
+	if !sort.StringsAreSorted(names) {
+		t.Error("expected sorted type names")
+	}
+	if i := sort.SearchStrings(names, serviceType); i == len(names) || names[i] != serviceType {
+		t.Errorf("expected %v among the named types", serviceType)
+	}
+	if !r.HasNamedType(serviceType) {
+		t.Errorf("expected HasNamedType(%q)", serviceType)
+	}
+	if r.HasNamedType("io.k8s.api.core.v1.Widget") {
+		t.Error("expected no Widget type")
+	}
+}
+
+func TestDanglingMappings(t *testing.T) {
+	ctx := context.Background()
+	r := newWidgetCreator(t, WithStrictTypeMappings(true))
+	if dangling := r.DanglingMappings(); len(dangling) != 0 {
+		t.Errorf("expected no dangling mappings, got %v", dangling)
+	}
+
+	// Simulate a GVK map out of step with the schema.
+	s, _ := r.types()
+	r.install(ctx, &convertedSchema{
+		schema:           s,
+		gvkToTypeNameMap: map[schema.GroupVersionKind]string{widgetGVK: "com.example.v1.Gadget"},
+	})
+	dangling := r.DanglingMappings()
+	if len(dangling) != 1 || dangling[widgetGVK] != "com.example.v1.Gadget" {
+		t.Errorf("expected the Widget mapping to dangle, got %v", dangling)
+	}
+	if objectType := r.ParseableType(ctx, widgetGVK); objectType.IsValid() {
+		t.Error("expected an invalid type for a dangling mapping")
+	}
+}
+
+func TestSchemaAtPointer(t *testing.T) {
+	r := newTestCreator(t)
+
+	for _, pointer := range []string{"/spec/ports/0/nodePort", "/spec/ports/-/nodePort"} {
+		atom, err := r.SchemaAtPointer(serviceGVK, pointer)
+		if err != nil {
+			t.Errorf("%v: %v", pointer, err)
+			continue
+		}
+		if atom.Scalar == nil || *atom.Scalar != mergeDiffSchema.Numeric {
+			t.Errorf("%v: expected a numeric scalar, got %+v", pointer, atom)
+		}
+	}
+
+	atom, err := r.SchemaAtPointer(serviceGVK, "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration")
+	if err != nil {
+		t.Fatalf("failed to resolve escaped pointer: %v", err)
+	}
+	if atom.Scalar == nil || *atom.Scalar != mergeDiffSchema.String {
+		t.Errorf("expected an annotation to be a string, got %+v", atom)
+	}
+
+	for _, pointer := range []string{"spec/ports", "/spec/ports/http", "/spec/unknown"} {
+		if _, err := r.SchemaAtPointer(serviceGVK, pointer); err == nil {
+			t.Errorf("%v: expected an error", pointer)
+		}
+	}
+}
+
+func TestValidateListKeys(t *testing.T) {
+	r := newTestCreator(t)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Service"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+	} {
+		if err := r.ValidateListKeys(gvk); err != nil {
+			t.Errorf("expected the list keys of %v to be valid: %v", gvk, err)
+		}
+	}
+	if err := r.ValidateListKeys(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Unknown"}); err == nil {
+		t.Error("expected an error for an unknown GVK")
+	}
+
+	listMap := `"type": "array",
+              "x-kubernetes-list-type": "map",
+              "x-kubernetes-list-map-keys": [%v],`
+	for keys, wantErr := range map[string]bool{
+		`"port", "protocol"`: false,
+		`"port", "options"`:  true,
+		`"name"`:             true,
+	} {
+		doc := strings.Replace(widgetOpenAPI, `"type": "array",`, fmt.Sprintf(listMap, keys), 1)
+		doc = strings.Replace(doc, `"protocol": {"type": "string", "default": "TCP"}`,
+			`"protocol": {"type": "string", "default": "TCP"}, "options": {"type": "object", "properties": {"tls": {"type": "boolean"}}}`, 1)
+		r, err := NewFromOpenAPIBytes(context.Background(), []byte(doc))
+		if err != nil {
+			t.Fatalf("failed to create creator: %v", err)
+		}
+		err = r.ValidateListKeys(widgetGVK)
+		if (err != nil) != wantErr {
+			t.Errorf("keys %v: expected error %v, got %v", keys, wantErr, err)
+		}
+	}
+}
+
+func TestApplyConfigTypeName(t *testing.T) {
+	r := newTestCreator(t)
+	tests := map[schema.GroupVersionKind]string{
+		serviceGVK: "ServiceApplyConfiguration",
+		{Group: "apps", Version: "v1", Kind: "Deployment"}: "DeploymentApplyConfiguration",
+		{Group: "batch", Version: "v1", Kind: "CronJob"}:   "CronJobApplyConfiguration",
+	}
+	for gvk, want := range tests {
+		got, err := r.ApplyConfigTypeName(gvk)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", gvk, err)
+		} else if got != want {
+			t.Errorf("%v: expected %v, got %v", gvk, want, got)
+		}
+	}
+	if _, err := r.ApplyConfigTypeName(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"}); err == nil {
+		t.Error("expected an error for an unknown GVK")
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+)
+
+// SchemaDiff is the structural difference between the schemas of two
+// Creators, see DiffSchemas.
+type SchemaDiff struct {
+	// AddedGVKs and RemovedGVKs are the GVKs only the new, respectively the
+	// old, schema maps to a type, sorted.
+	AddedGVKs   []schema.GroupVersionKind
+	RemovedGVKs []schema.GroupVersionKind
+	// ChangedTypes are the named types defined by both schemas whose shape
+	// differs, sorted by name.
+	ChangedTypes []TypeChange
+}
+
+// TypeChange describes how a named type changed between two schemas. Paths
+// are relative to the type and use the FormatPath syntax, with "[*]" standing
+// for any element of a list, e.g. ".spec.ports[*].port"; the type itself is
+// at "".
+type TypeChange struct {
+	Name          string
+	AddedFields   []string
+	RemovedFields []string
+	Changed       []FieldChange
+}
+
+// FieldChange is a field whose kind of value changed, e.g. a list whose
+// merge relationship went from "set" to "associative(name)". Old and New are
+// descriptions as printed by Explain.
+type FieldChange struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%v: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Breaking reports whether the diff contains changes that can break existing
+// objects or clients: removed GVKs, removed fields or changed fields. Added
+// GVKs and fields are compatible.
+func (d *SchemaDiff) Breaking() bool {
+	if len(d.RemovedGVKs) > 0 {
+		return true
+	}
+	for _, change := range d.ChangedTypes {
+		if len(change.RemovedFields) > 0 || len(change.Changed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffSchemas compares the schemas of old and new, e.g. Creators built from
+// the OpenAPI documents of a cluster before and after an upgrade. It reports
+// the GVKs added and removed, and, for the named types both define, the
+// fields added and removed and the fields whose kind of value or list
+// relationship changed. Field order, descriptions and defaults are ignored.
+// Fields referring to a named type are not followed; that type is compared on
+// its own.
+func DiffSchemas(old, new *Creator) (*SchemaDiff, error) {
+	if old == nil || new == nil {
+		return nil, fmt.Errorf("creators cannot be nil")
+	}
+	oldSchema, oldGVKs := old.types()
+	newSchema, newGVKs := new.types()
+
+	diff := &SchemaDiff{}
+	for gvk := range newGVKs {
+		if _, ok := oldGVKs[gvk]; !ok {
+			diff.AddedGVKs = append(diff.AddedGVKs, gvk)
+		}
+	}
+	for gvk := range oldGVKs {
+		if _, ok := newGVKs[gvk]; !ok {
+			diff.RemovedGVKs = append(diff.RemovedGVKs, gvk)
+		}
+	}
+	sortGVKs(diff.AddedGVKs)
+	sortGVKs(diff.RemovedGVKs)
+
+	for _, name := range old.NamedTypes() {
+		oldDef, ok := oldSchema.FindNamedType(name)
+		if !ok {
+			continue
+		}
+		newDef, ok := newSchema.FindNamedType(name)
+		if !ok {
+			continue
+		}
+		change := TypeChange{Name: name}
+		d := &schemaDiffer{old: oldSchema, new: newSchema, change: &change}
+		d.compare(oldDef.Atom, newDef.Atom, "")
+		sort.Strings(change.AddedFields)
+		sort.Strings(change.RemovedFields)
+		if len(change.AddedFields) > 0 || len(change.RemovedFields) > 0 || len(change.Changed) > 0 {
+			diff.ChangedTypes = append(diff.ChangedTypes, change)
+		}
+	}
+	return diff, nil
+}
+
+// sortGVKs sorts gvks by group, version and kind.
+func sortGVKs(gvks []schema.GroupVersionKind) {
+	sort.Slice(gvks, func(i, j int) bool {
+		if gvks[i].Group != gvks[j].Group {
+			return gvks[i].Group < gvks[j].Group
+		}
+		if gvks[i].Version != gvks[j].Version {
+			return gvks[i].Version < gvks[j].Version
+		}
+		return gvks[i].Kind < gvks[j].Kind
+	})
+}
+
+// schemaDiffer records the differences between two versions of a named type
+// into change.
+type schemaDiffer struct {
+	old, new *mergeDiffSchema.Schema
+	change   *TypeChange
+}
+
+// compare records the differences between the atoms found at path, then
+// descends into their inlined fields and list elements.
+func (d *schemaDiffer) compare(oldAtom, newAtom mergeDiffSchema.Atom, path string) {
+	if oldDesc, newDesc := describeAtom(oldAtom), describeAtom(newAtom); oldDesc != newDesc {
+		d.change.Changed = append(d.change.Changed, FieldChange{Path: path, Old: oldDesc, New: newDesc})
+		return
+	}
+	if oldAtom.List != nil && newAtom.List != nil {
+		d.compareRefs(oldAtom.List.ElementType, newAtom.List.ElementType, path+"[*]")
+	}
+	if oldAtom.Map == nil || newAtom.Map == nil {
+		return
+	}
+	for _, field := range newAtom.Map.Fields {
+		if _, ok := oldAtom.Map.FindField(field.Name); !ok {
+			d.change.AddedFields = append(d.change.AddedFields, fieldPath(path, field.Name))
+		}
+	}
+	for _, field := range oldAtom.Map.Fields {
+		newField, ok := newAtom.Map.FindField(field.Name)
+		if !ok {
+			d.change.RemovedFields = append(d.change.RemovedFields, fieldPath(path, field.Name))
+			continue
+		}
+		d.compareRefs(field.Type, newField.Type, fieldPath(path, field.Name))
+	}
+}
+
+// compareRefs compares the types referred to at path. References to the
+// same named type are left to the comparison of that type.
+func (d *schemaDiffer) compareRefs(oldRef, newRef mergeDiffSchema.TypeRef, path string) {
+	if oldRef.NamedType != nil && newRef.NamedType != nil && *oldRef.NamedType == *newRef.NamedType {
+		return
+	}
+	oldAtom, ok := d.old.Resolve(oldRef)
+	if !ok {
+		return
+	}
+	newAtom, ok := d.new.Resolve(newRef)
+	if !ok {
+		return
+	}
+	if oldRef.NamedType != nil || newRef.NamedType != nil {
+		// Only compare the shape of renamed or newly extracted types, so
+		// recursive types are not followed forever.
+		if oldDesc, newDesc := describeAtom(oldAtom), describeAtom(newAtom); oldDesc != newDesc {
+			d.change.Changed = append(d.change.Changed, FieldChange{Path: path, Old: oldDesc, New: newDesc})
+		}
+		return
+	}
+	d.compare(oldAtom, newAtom, path)
+}
+
+// fieldPath appends the field name to path.
+func fieldPath(path, name string) string {
+	return path + FormatPath(fieldpath.Path{{FieldName: &name}})
+}
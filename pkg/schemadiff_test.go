@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	old := newWidgetCreator(t)
+
+	diff, err := DiffSchemas(old, newWidgetCreator(t))
+	if err != nil {
+		t.Fatalf("failed to diff schemas: %v", err)
+	}
+	if len(diff.AddedGVKs) != 0 || len(diff.RemovedGVKs) != 0 || len(diff.ChangedTypes) != 0 || diff.Breaking() {
+		t.Errorf("expected no differences for the same schema, got %+v", diff)
+	}
+
+	doc := strings.Replace(widgetOpenAPI, `"size": {"type": "integer"},`, `"replicas": {"type": "integer"},`, 1)
+	doc = strings.Replace(doc, `"mode": {"type": "string", "default": "auto"},`, `"mode": {"type": "object", "properties": {"name": {"type": "string"}}},`, 1)
+	doc = strings.Replace(doc, `"type": "array",`, `"type": "array", "x-kubernetes-list-type": "map", "x-kubernetes-list-map-keys": ["port"],`, 1)
+	doc = strings.Replace(doc, `"kind": "Widget"}]`, `"kind": "Gadget"}]`, 1)
+	updated, err := NewFromOpenAPIBytes(context.Background(), []byte(doc))
+	if err != nil {
+		t.Fatalf("failed to create creator: %v", err)
+	}
+
+	diff, err = DiffSchemas(old, updated)
+	if err != nil {
+		t.Fatalf("failed to diff schemas: %v", err)
+	}
+	gadgetGVK := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"}
+	if !reflect.DeepEqual(diff.AddedGVKs, []schema.GroupVersionKind{gadgetGVK}) || !reflect.DeepEqual(diff.RemovedGVKs, []schema.GroupVersionKind{widgetGVK}) {
+		t.Errorf("expected Widget to be replaced by Gadget, got added %v, removed %v", diff.AddedGVKs, diff.RemovedGVKs)
+	}
+	want := []TypeChange{{
+		Name:          "com.example.v1.Widget",
+		AddedFields:   []string{".spec.replicas"},
+		RemovedFields: []string{".spec.size"},
+		Changed: []FieldChange{
+			{Path: ".spec.mode", Old: "scalar string", New: "map"},
+			{Path: ".spec.ports", Old: "list, atomic", New: "list, associative(port)"},
+		},
+	}}
+	if !reflect.DeepEqual(diff.ChangedTypes, want) {
+		t.Errorf("expected changes %+v, got %+v", want, diff.ChangedTypes)
+	}
+	if !diff.Breaking() {
+		t.Error("expected the diff to be breaking")
+	}
+}
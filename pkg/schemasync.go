@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StartSchemaSync reloads the schema every interval in the background until
+// ctx is cancelled, so a long-lived Creator picks up CRDs installed at
+// runtime. Each reload swaps the schema atomically; callers holding a
+// ParseableType keep the schema it was built from. GVKs appearing or
+// disappearing are logged, and a failed reload is logged and leaves the
+// current schema in place.
+func (r *Creator) StartSchemaSync(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("schema sync interval must be positive, got %v", interval)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.reload(ctx); err != nil {
+					r.logger(ctx).Error(err, "Failed to reload schema")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// LastSchemaSync returns when the schema was last loaded successfully.
+func (r *Creator) LastSchemaSync() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastSync
+}
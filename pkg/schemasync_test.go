@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStartSchemaSync(t *testing.T) {
+	r := newTestCreator(t)
+	loaded := r.LastSchemaSync()
+	if loaded.IsZero() {
+		t.Fatal("expected the initial load to be recorded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := r.StartSchemaSync(ctx, 0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+	if err := r.StartSchemaSync(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("failed to start schema sync: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.LastSchemaSync().After(loaded) {
+		if time.Now().After(deadline) {
+			t.Fatal("schema was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.ParseableType(ctx, serviceGVK) == nil {
+		t.Error("expected Service to resolve after a reload")
+	}
+}
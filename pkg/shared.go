@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// maxSharedSchemas bounds the number of unreferenced schemas kept by
+// NewShared.
+const maxSharedSchemas = 8
+
+// sharedSchemas caches the schemas converted by NewShared.
+var sharedSchemas = &schemaCache{entries: map[string]*sharedSchema{}}
+
+// NewShared is New for applications that create many short-lived Creators for
+// the same clusters. The converted schema is cached by apiserver host and
+// digest of the OpenAPI document, so Creators built while the document is
+// unchanged share one conversion; the document itself is still fetched to
+// detect CRD changes. NewShared is safe to call concurrently, and Creators
+// sharing a schema may be used concurrently.
+//
+// Callers should Close the Creator once done with it. A schema stays cached
+// while any Creator using it is open; of the schemas no longer in use, the
+// most recently released maxSharedSchemas are kept and older ones evicted.
+// Creators built by NewShared use the default options.
+func NewShared(ctx context.Context, restConfig *rest.Config) (*Creator, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %v", err)
+	}
+	doc, err := dc.OpenAPISchema()
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest OpenAPI document: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	key := restConfig.Host + "@" + hex.EncodeToString(sum[:])
+
+	creator := &Creator{
+		restConfig: restConfig,
+		src:        dc,
+	}
+	converted, err := sharedSchemas.acquire(key, func() (*convertedSchema, error) {
+		return creator.convert(ctx, doc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	creator.release = func() { sharedSchemas.release(key) }
+	creator.install(ctx, converted)
+	return creator, nil
+}
+
+// Close releases the Creator's reference to a schema shared by NewShared,
+// making it eligible for eviction. The Creator remains usable. Close is a
+// no-op for other Creators and when called again.
+func (r *Creator) Close() {
+	r.releaseOnce.Do(func() {
+		if r.release != nil {
+			r.release()
+		}
+	})
+}
+
+// schemaCache holds converted schemas by key, counting the Creators using
+// each of them.
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[string]*sharedSchema
+	// released orders the releases of entries, for eviction.
+	released uint64
+}
+
+type sharedSchema struct {
+	once      sync.Once
+	converted *convertedSchema
+	err       error
+
+	refs         int
+	lastReleased uint64
+}
+
+// acquire returns the schema cached under key, converting it with convert
+// when missing. Concurrent callers for the same key share one conversion. The
+// reference taken must be dropped with release, unless an error is returned.
+func (c *schemaCache) acquire(key string, convert func() (*convertedSchema, error)) (*convertedSchema, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &sharedSchema{}
+		c.entries[key] = entry
+	}
+	entry.refs++
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.converted, entry.err = convert()
+	})
+	if entry.err != nil {
+		c.mu.Lock()
+		entry.refs--
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return nil, entry.err
+	}
+	return entry.converted, nil
+}
+
+// release drops a reference to the schema cached under key and evicts the
+// least recently released unreferenced schemas beyond maxSharedSchemas.
+func (c *schemaCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.refs == 0 {
+		return
+	}
+	entry.refs--
+	c.released++
+	entry.lastReleased = c.released
+
+	for {
+		var unused int
+		var oldestKey string
+		var oldest *sharedSchema
+		for k, e := range c.entries {
+			if e.refs > 0 {
+				continue
+			}
+			unused++
+			if oldest == nil || e.lastReleased < oldest.lastReleased {
+				oldestKey, oldest = k, e
+			}
+		}
+		if unused <= maxSharedSchemas {
+			return
+		}
+		delete(c.entries, oldestKey)
+	}
+}
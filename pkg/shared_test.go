@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestNewShared(t *testing.T) {
+	ctx := context.Background()
+	first, err := NewShared(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to create shared creator: %v", err)
+	}
+	defer first.Close()
+	second, err := NewShared(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to create shared creator: %v", err)
+	}
+	defer second.Close()
+
+	firstSchema, _ := first.types()
+	secondSchema, _ := second.types()
+	if firstSchema != secondSchema {
+		t.Error("expected the creators to share the converted schema")
+	}
+	if second.ParseableType(ctx, serviceGVK) == nil {
+		t.Error("expected the shared schema to resolve Services")
+	}
+}
+
+func TestSchemaCacheEviction(t *testing.T) {
+	c := &schemaCache{entries: map[string]*sharedSchema{}}
+	conversions := 0
+	convert := func() (*convertedSchema, error) {
+		conversions++
+		return &convertedSchema{}, nil
+	}
+
+	if _, err := c.acquire("in-use", convert); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	for i := 0; i < maxSharedSchemas+2; i++ {
+		key := fmt.Sprint(i)
+		if _, err := c.acquire(key, convert); err != nil {
+			t.Fatalf("failed to acquire %v: %v", key, err)
+		}
+		c.release(key)
+	}
+	if len(c.entries) != maxSharedSchemas+1 {
+		t.Errorf("expected %d entries, got %d", maxSharedSchemas+1, len(c.entries))
+	}
+	for _, key := range []string{"in-use", fmt.Sprint(maxSharedSchemas + 1)} {
+		if _, ok := c.entries[key]; !ok {
+			t.Errorf("expected %q to be kept", key)
+		}
+	}
+	if _, ok := c.entries["0"]; ok {
+		t.Error("expected the least recently released schema to be evicted")
+	}
+
+	before := conversions
+	if _, err := c.acquire("in-use", convert); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	if conversions != before {
+		t.Error("expected a cached schema not to be converted again")
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+// Subtract returns a copy of obj with the leaf paths of set removed. It is the
+// answer to "what would remain if the owner of set were removed".
+//
+// Associative-list elements are handled as a unit: an element is removed
+// whole when one of its key fields is subtracted, or when subtracting leaves
+// nothing in it but its key fields. Fields left empty by the removal are
+// pruned from the result.
+func (r *Creator) Subtract(ctx context.Context, obj *unstructured.Unstructured, set *fieldpath.Set) (*unstructured.Unstructured, error) {
+	tv, err := r.typedObject(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil || set.Empty() {
+		return obj.DeepCopy(), nil
+	}
+
+	result, err := subtractTyped(tv, set)
+	if err != nil {
+		return nil, err
+	}
+	u, err := ToUnstructured(result)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(u.Object)
+	return u, nil
+}
+
+// subtractTyped removes the leaf paths of set from tv, handling
+// associative-list elements as described on Subtract.
+func subtractTyped(tv *typed.TypedValue, set *fieldpath.Set) (*typed.TypedValue, error) {
+	leaves := set.Leaves()
+	toRemove := leaves.Union(fieldpath.NewSet())
+	touched := fieldpath.NewSet()
+	leaves.Iterate(func(p fieldpath.Path) {
+		for i, pe := range p {
+			if pe.Key == nil {
+				continue
+			}
+			element := p[:i+1].Copy()
+			touched.Insert(element)
+			if i == len(p)-2 && isKeyField(pe, p[i+1]) {
+				toRemove.Insert(element)
+			}
+		}
+	})
+
+	return removeKeyOnlyElements(tv.RemoveItems(toRemove), touched)
+}
+
+// removeKeyOnlyElements removes each associative-list element in elements
+// that holds nothing but its key fields. Deeper elements are handled first so
+// that emptying a nested list can cascade to its parent element.
+func removeKeyOnlyElements(tv *typed.TypedValue, elements *fieldpath.Set) (*typed.TypedValue, error) {
+	var paths []fieldpath.Path
+	elements.Iterate(func(p fieldpath.Path) {
+		paths = append(paths, p.Copy())
+	})
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+
+	for _, p := range paths {
+		fieldSet, err := tv.ToFieldSet()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute field set: %v", err)
+		}
+		if !fieldSet.Has(p) {
+			continue
+		}
+		keyOnly := true
+		descend(fieldSet, p).Leaves().Iterate(func(child fieldpath.Path) {
+			if len(child) != 1 || !isKeyField(p[len(p)-1], child[0]) {
+				keyOnly = false
+			}
+		})
+		if keyOnly {
+			tv = tv.RemoveItems(fieldpath.NewSet(p))
+		}
+	}
+	return tv, nil
+}
+
+// isKeyField reports whether field names one of the key fields of the
+// associative-list element pe.
+func isKeyField(pe, field fieldpath.PathElement) bool {
+	if pe.Key == nil || field.FieldName == nil {
+		return false
+	}
+	for _, key := range *pe.Key {
+		if key.Name == *field.FieldName {
+			return true
+		}
+	}
+	return false
+}
+
+// descend returns the subset of s found under the path p.
+func descend(s *fieldpath.Set, p fieldpath.Path) *fieldpath.Set {
+	for _, pe := range p {
+		s = s.WithPrefix(pe)
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+var issuePortKey = fieldpath.KeyByFields("port", 80, "protocol", "TCP")
+
+func TestSubtract(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+
+	nodePort := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "ports", issuePortKey, "nodePort"))
+	result, err := r.Subtract(ctx, object, nodePort)
+	if err != nil {
+		t.Fatalf("failed to subtract: %v", err)
+	}
+	ports, _, _ := unstructured.NestedSlice(result.Object, "spec", "ports")
+	if len(ports) != 1 {
+		t.Fatalf("expected the port element to remain, got %v", ports)
+	}
+	port := ports[0].(map[string]interface{})
+	if _, ok := port["nodePort"]; ok {
+		t.Errorf("expected nodePort to be removed, got %v", port)
+	}
+	for _, field := range []string{"name", "port", "protocol", "targetPort"} {
+		if _, ok := port[field]; !ok {
+			t.Errorf("expected %v to remain in %v", field, port)
+		}
+	}
+	if ports, _, _ := unstructured.NestedSlice(object.Object, "spec", "ports"); ports[0].(map[string]interface{})["nodePort"] == nil {
+		t.Error("input object must not be modified")
+	}
+
+	// Subtracting every non-key field removes the element entirely.
+	allFields := fieldpath.NewSet()
+	for _, field := range []string{"name", "nodePort", "targetPort"} {
+		allFields.Insert(fieldpath.MakePathOrDie("spec", "ports", issuePortKey, field))
+	}
+	result, err = r.Subtract(ctx, object, allFields)
+	if err != nil {
+		t.Fatalf("failed to subtract: %v", err)
+	}
+	if ports, ok, _ := unstructured.NestedSlice(result.Object, "spec", "ports"); ok {
+		t.Errorf("expected the port element to be removed, got %v", ports)
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// ThreeWayMerge applies the changes from original to modified onto current,
+// like a client-side "kubectl apply" with original as the last applied
+// configuration, and returns the result. Fields are compared with their
+// schema, so reordering an associative list or a set is not a change.
+//
+// A conflict is a field both modified and current changed from original, to
+// different values. Conflicts do not fail the merge: modified's change wins
+// and the field is reported, with the manager owning it in current if
+// current's managedFields say so. managedFields take no part in the merge;
+// the result has none.
+func (r *Creator) ThreeWayMerge(ctx context.Context, original, modified, current *unstructured.Unstructured) (*unstructured.Unstructured, []Conflict, error) {
+	if original == nil || modified == nil || current == nil {
+		return nil, nil, fmt.Errorf("original, modified and current objects cannot be nil")
+	}
+	gvk, err := ObjectGVK(current)
+	if err != nil {
+		return nil, nil, fmt.Errorf("current: %v", err)
+	}
+	for name, obj := range map[string]*unstructured.Unstructured{"original": original, "modified": modified} {
+		objGVK, err := ObjectGVK(obj)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: %v", name, err)
+		}
+		if objGVK != gvk {
+			return nil, nil, fmt.Errorf("cannot merge %v %v into %v", name, objGVK, gvk)
+		}
+	}
+	originalTV, err := r.typedObject(ctx, withoutManagedFields(original))
+	if err != nil {
+		return nil, nil, err
+	}
+	modifiedTV, err := r.typedObject(ctx, withoutManagedFields(modified))
+	if err != nil {
+		return nil, nil, err
+	}
+	currentTV, err := r.typedObject(ctx, withoutManagedFields(current))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := originalTV.Compare(modifiedTV)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compare original and modified: %v", err)
+	}
+	drift, err := originalTV.Compare(currentTV)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compare original and current: %v", err)
+	}
+	changed := changes.Modified.Union(changes.Added).Leaves()
+	removed := changes.Removed.Leaves()
+
+	var conflicts []Conflict
+	modifiedU, currentU := modifiedTV.AsValue().Unstructured(), currentTV.AsValue().Unstructured()
+	changed.Union(removed).Intersection(drift.Modified.Union(drift.Added).Union(drift.Removed).Leaves()).Iterate(func(p fieldpath.Path) {
+		modifiedVal, modifiedOK := valueAtPath(modifiedU, p)
+		currentVal, currentOK := valueAtPath(currentU, p)
+		if modifiedOK == currentOK && value.Equals(value.NewValueInterface(modifiedVal), value.NewValueInterface(currentVal)) {
+			return
+		}
+		conflicts = append(conflicts, Conflict{Manager: fieldOwner(current, p), Path: p.Copy()})
+	})
+
+	merged, err := currentTV.Merge(ExtractItemsWithKeys(modifiedTV, changed))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to merge objects: %v", err)
+	}
+	// Removing a key field of an associative-list element removes the
+	// element, as modified no longer has it.
+	toRemove := removed.Union(fieldpath.NewSet())
+	removed.Iterate(func(p fieldpath.Path) {
+		if n := len(p); n >= 2 && p[n-2].Key != nil && isKeyField(p[n-2], p[n-1]) {
+			toRemove.Insert(p[:n-1].Copy())
+		}
+	})
+	result, err := ToUnstructured(merged.RemoveItems(toRemove))
+	if err != nil {
+		return nil, nil, err
+	}
+	pruneNulls(result.Object)
+	return result, conflicts, nil
+}
+
+// fieldOwner returns the first manager of obj whose managedFields record p,
+// or "".
+func fieldOwner(obj *unstructured.Unstructured, p fieldpath.Path) string {
+	for _, entry := range obj.GetManagedFields() {
+		set, err := SetFromManagedField(entry)
+		if err == nil && set.Has(p) {
+			return entry.Manager
+		}
+	}
+	return ""
+}
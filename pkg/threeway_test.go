@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	original := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"type":"ClusterIP","sessionAffinity":"None","selector":{"app":"web"},"ports":[{"name":"http","port":80,"protocol":"TCP"},{"port":443,"protocol":"TCP"}]}}`)
+	modified := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"type":"NodePort","sessionAffinity":"ClientIP","selector":{"app":"web"},"ports":[{"port":80,"protocol":"TCP"}]}}`)
+	current := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc","managedFields":[{"apiVersion":"v1","fieldsType":"FieldsV1","fieldsV1":{"f:spec":{"f:type":{}}},"manager":"kubectl-edit","operation":"Update"}]},"spec":{"type":"LoadBalancer","sessionAffinity":"None","selector":{"app":"web","tier":"frontend"},"ports":[{"name":"http","port":80,"protocol":"TCP"},{"port":443,"protocol":"TCP"}]}}`)
+
+	merged, conflicts, err := r.ThreeWayMerge(ctx, original, modified, current)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	want := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ports":[{"port":80,"protocol":"TCP"}],"selector":{"app":"web","tier":"frontend"},"sessionAffinity":"ClientIP","type":"NodePort"}}`
+	if got := JsonObjectToString(merged.Object); got != want {
+		t.Errorf("unexpected merge result:\n got: %v\nwant: %v", got, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].String() != `.spec.type owned by "kubectl-edit"` {
+		t.Errorf("expected a single conflict on .spec.type, got %v", conflicts)
+	}
+
+	current.Object["spec"].(map[string]interface{})["type"] = "NodePort"
+	if _, conflicts, err = r.ThreeWayMerge(ctx, original, modified, current); err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflict when both sides make the same change, got %v", conflicts)
+	}
+}
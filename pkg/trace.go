@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+// TraceEventType names a step of an extraction or merge reported to the
+// tracer set with WithTrace.
+type TraceEventType string
+
+const (
+	// TraceExtractStart starts the extraction of Manager's fields. Manager
+	// is empty for extractions not tied to one, such as ExtractComplement,
+	// and lists the managers of ExtractManagers separated by commas.
+	TraceExtractStart TraceEventType = "extract-start"
+	// TraceSetParsed reports, in Paths, the leaf fields to extract, e.g.
+	// those recorded for Manager in the object's managedFields.
+	TraceSetParsed TraceEventType = "set-parsed"
+	// TraceKeyInjected reports a list key field at Path added to an
+	// extraction so the list element it belongs to stays mergeable.
+	TraceKeyInjected TraceEventType = "key-injected"
+	// TraceMergeAttempt starts a merge by MergeObjects.
+	TraceMergeAttempt TraceEventType = "merge-attempt"
+	// TraceMergeError reports a failed merge. Schema violations are reported
+	// one event each, with the offending Path.
+	TraceMergeError TraceEventType = "merge-error"
+)
+
+// TraceEvent is a step of an extraction or merge. Fields that do not apply to
+// the step are left empty.
+type TraceEvent struct {
+	Type    TraceEventType
+	GVK     schema.GroupVersionKind
+	Manager string
+	// Path is the field the event is about, in the FormatPath syntax for
+	// extractions and as reported by structured-merge-diff for merge errors.
+	Path  string
+	Paths []string
+	Err   error
+}
+
+// trace reports event to the tracer, if any. Callers building costly events
+// check r.tracer themselves first.
+func (r *Creator) trace(event TraceEvent) {
+	if r.tracer != nil {
+		r.traceMu.Lock()
+		defer r.traceMu.Unlock()
+		r.tracer(event)
+	}
+}
+
+// traceMergeError reports err, a failed merge of objects of type gvk, with one
+// event per schema violation it holds, or a single event otherwise.
+func (r *Creator) traceMergeError(gvk schema.GroupVersionKind, err error) {
+	if r.tracer == nil {
+		return
+	}
+	var violations typed.ValidationErrors
+	if !errors.As(err, &violations) || len(violations) == 0 {
+		r.trace(TraceEvent{Type: TraceMergeError, GVK: gvk, Err: err})
+		return
+	}
+	for _, violation := range violations {
+		r.trace(TraceEvent{Type: TraceMergeError, GVK: gvk, Path: violation.Path, Err: violation})
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithTrace(t *testing.T) {
+	ctx := context.Background()
+	var events []TraceEvent
+	r := newTestCreator(t, WithTrace(func(event TraceEvent) {
+		events = append(events, event)
+	}))
+
+	if _, err := r.ExtractManager(ctx, jsonToUnstructured(issueServiceJSON), "kubectl-edit"); err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	var types []TraceEventType
+	var injected []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		if event.Manager != "kubectl-edit" {
+			t.Errorf("expected %v event for kubectl-edit, got %q", event.Type, event.Manager)
+		}
+		switch event.Type {
+		case TraceSetParsed:
+			if want := []string{`.spec.ports[port=80,protocol="TCP"].nodePort`}; !reflect.DeepEqual(event.Paths, want) {
+				t.Errorf("expected parsed set %v, got %v", want, event.Paths)
+			}
+		case TraceKeyInjected:
+			injected = append(injected, event.Path)
+		}
+	}
+	if want := []TraceEventType{TraceExtractStart, TraceSetParsed, TraceKeyInjected, TraceKeyInjected}; !reflect.DeepEqual(types, want) {
+		t.Errorf("expected events %v, got %v", want, types)
+	}
+	if want := []string{`.spec.ports[port=80,protocol="TCP"].port`, `.spec.ports[port=80,protocol="TCP"].protocol`}; !reflect.DeepEqual(injected, want) {
+		t.Errorf("expected injected keys %v, got %v", want, injected)
+	}
+
+	// The other extract functions are traced alike.
+	events = nil
+	if _, err := r.ExtractAllManagers(ctx, jsonToUnstructured(issueServiceJSON)); err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+	started := map[string]bool{}
+	for _, event := range events {
+		if event.Type == TraceExtractStart {
+			started[event.Manager] = true
+		}
+	}
+	if want := map[string]bool{"kubectl-client-side-apply": true, "kubectl-edit": true}; !reflect.DeepEqual(started, want) {
+		t.Errorf("expected an extraction to start for every manager, got %v", started)
+	}
+
+	events = nil
+	malformed := jsonToUnstructured(issueServiceJSON)
+	malformed.SetAPIVersion("a/b/c")
+	if _, err := r.ExtractManager(ctx, malformed, "kubectl-edit"); err == nil {
+		t.Error("expected an error for a malformed apiVersion")
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events for a malformed apiVersion, got %+v", events)
+	}
+
+	events = nil
+	base := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ports":[{"port":80,"protocol":"TCP"}]}}`)
+	keyless := jsonToUnstructured(`{"apiVersion":"v1","kind":"Service","metadata":{"name":"svc"},"spec":{"ports":[{"nodePort":30001}]}}`)
+	if _, err := r.MergeObjects(ctx, base, keyless); err == nil {
+		t.Fatal("expected merging a keyless list element to fail")
+	}
+	if len(events) != 2 || events[0].Type != TraceMergeAttempt || events[1].Type != TraceMergeError {
+		t.Fatalf("expected a merge attempt and a merge error, got %+v", events)
+	}
+	if !strings.Contains(events[1].Path, "ports") || events[1].Err == nil {
+		t.Errorf("expected the merge error to point at the ports list, got %+v", events[1])
+	}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ValidationResult is the outcome of validating one document of a manifest
+// stream.
+type ValidationResult struct {
+	// Document is the zero-based index of the document in the stream,
+	// empty documents excluded.
+	Document int
+	// GVK is the GVK of the object, zero when its apiVersion or kind is
+	// missing or malformed.
+	GVK schema.GroupVersionKind
+	// OK is true when the object conforms to its schema.
+	OK bool
+	// UnknownGVK is true when the schema has no type for GVK. Err is set
+	// as well.
+	UnknownGVK bool
+	Err        error
+}
+
+// ValidateStream validates every object of a multi-document YAML (or JSON)
+// manifest stream against the schema for its GVK, e.g. to lint manifests in
+// CI. Schema violations and unknown GVKs are reported per document; only a
+// stream that cannot be read or decoded returns an error.
+func (r *Creator) ValidateStream(ctx context.Context, in io.Reader) ([]ValidationResult, error) {
+	_, gvkToTypeNameMap := r.types()
+	reader := yaml.NewYAMLReader(bufio.NewReader(in))
+	results := []ValidationResult{}
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return results, nil
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to read document %d: %v", len(results), err)
+		}
+		if len(strings.TrimSpace(string(doc))) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(doc), len(doc)).Decode(&obj.Object); err != nil {
+			return results, fmt.Errorf("failed to decode document %d: %v", len(results), err)
+		}
+		if obj.Object == nil {
+			continue
+		}
+
+		result := ValidationResult{Document: len(results)}
+		if result.GVK, err = ObjectGVK(obj); err != nil {
+			result.UnknownGVK = true
+			result.Err = err
+		} else if _, ok := gvkToTypeNameMap[result.GVK]; !ok {
+			result.UnknownGVK = true
+			result.Err = fmt.Errorf("no schema found for GVK %v", result.GVK)
+		} else if _, err := r.typedObject(ctx, obj); err != nil {
+			result.Err = err
+		} else {
+			result.OK = true
+		}
+		results = append(results, result)
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidateStream(t *testing.T) {
+	r := newTestCreator(t)
+	stream := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+    protocol: TCP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: broken
+spec:
+  ports: 80
+---
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+---
+apiVersion: a/b/c
+kind: Service
+metadata:
+  name: malformed
+`
+	results, err := r.ValidateStream(context.Background(), strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("failed to validate stream: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %+v", results)
+	}
+	if !results[0].OK || results[0].GVK != serviceGVK {
+		t.Errorf("expected the first Service to be valid, got %+v", results[0])
+	}
+	if results[1].OK || results[1].UnknownGVK || results[1].Err == nil {
+		t.Errorf("expected a schema violation for the second Service, got %+v", results[1])
+	}
+	if results[2].OK || !results[2].UnknownGVK || results[2].GVK.Kind != "Widget" {
+		t.Errorf("expected Widget to be reported as unknown, got %+v", results[2])
+	}
+	if results[3].OK || !results[3].UnknownGVK || !results[3].GVK.Empty() || results[3].Err == nil || !strings.Contains(results[3].Err.Error(), "invalid apiVersion") {
+		t.Errorf("expected the malformed apiVersion to be reported with a zero GVK, got %+v", results[3])
+	}
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	mergeDiffSchema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// WalkTyped visits every leaf of tv in a schema-guided depth-first traversal.
+// Leaves are scalars, atomic lists and maps, and empty containers. Map fields
+// are visited in sorted order; list items in list order. Items of
+// associative lists are addressed by their keys (including defaulted keys),
+// items of sets by their value, so paths match those in managedFields.
+// Walking stops at the first error returned by visit.
+func WalkTyped(tv *typed.TypedValue, visit func(path fieldpath.Path, v value.Value) error) error {
+	if tv == nil {
+		return fmt.Errorf("typed value cannot be nil")
+	}
+	w := &typedWalker{schema: tv.Schema(), visit: visit}
+	return w.walk(fieldpath.Path{}, tv.TypeRef(), tv.AsValue())
+}
+
+type typedWalker struct {
+	schema *mergeDiffSchema.Schema
+	visit  func(path fieldpath.Path, v value.Value) error
+}
+
+func (w *typedWalker) walk(path fieldpath.Path, tr mergeDiffSchema.TypeRef, v value.Value) error {
+	if v == nil || v.IsNull() {
+		return w.visit(path, v)
+	}
+	atom, ok := w.schema.Resolve(tr)
+	if !ok {
+		return fmt.Errorf("%v: unresolvable type reference", FormatPath(path))
+	}
+	switch {
+	case v.IsMap() && atom.Map != nil:
+		return w.walkMap(path, atom.Map, v)
+	case v.IsList() && atom.List != nil:
+		return w.walkList(path, atom.List, v)
+	case atom.Scalar != nil:
+		return w.visit(path, v)
+	default:
+		return fmt.Errorf("%v: value does not match schema", FormatPath(path))
+	}
+}
+
+func (w *typedWalker) walkMap(path fieldpath.Path, m *mergeDiffSchema.Map, mv value.Value) error {
+	v := mv.AsMap()
+	if m.ElementRelationship == mergeDiffSchema.Atomic || v.Empty() {
+		return w.visit(path, mv)
+	}
+	keys := make([]string, 0, v.Length())
+	v.Iterate(func(k string, _ value.Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Strings(keys)
+	for _, k := range keys {
+		fieldType := m.ElementType
+		if field, ok := m.FindField(k); ok {
+			fieldType = field.Type
+		}
+		item, _ := v.Get(k)
+		name := k
+		if err := w.walk(appendPath(path, fieldpath.PathElement{FieldName: &name}), fieldType, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *typedWalker) walkList(path fieldpath.Path, l *mergeDiffSchema.List, lv value.Value) error {
+	v := lv.AsList()
+	if l.ElementRelationship == mergeDiffSchema.Atomic || v.Length() == 0 {
+		return w.visit(path, lv)
+	}
+	for i := 0; i < v.Length(); i++ {
+		item := v.At(i)
+		pe, err := w.listItemPathElement(l, item)
+		if err != nil {
+			return fmt.Errorf("%v: element %d: %v", FormatPath(path), i, err)
+		}
+		if err := w.walk(appendPath(path, pe), l.ElementType, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listItemPathElement addresses an item of a non-atomic list: by key for
+// associative lists with keys, by value for sets.
+func (w *typedWalker) listItemPathElement(l *mergeDiffSchema.List, item value.Value) (fieldpath.PathElement, error) {
+	if len(l.Keys) == 0 {
+		v := item
+		return fieldpath.PathElement{Value: &v}, nil
+	}
+	if !item.IsMap() {
+		return fieldpath.PathElement{}, fmt.Errorf("associative list item is not a map")
+	}
+	m := item.AsMap()
+	key := value.FieldList{}
+	for _, name := range l.Keys {
+		if v, ok := m.Get(name); ok {
+			key = append(key, value.Field{Name: name, Value: v})
+			continue
+		}
+		def, ok := w.keyDefault(l, name)
+		if !ok {
+			return fieldpath.PathElement{}, fmt.Errorf("element omits key field %q", name)
+		}
+		key = append(key, value.Field{Name: name, Value: value.NewValueInterface(def)})
+	}
+	key.Sort()
+	return fieldpath.PathElement{Key: &key}, nil
+}
+
+// keyDefault returns the schema default of the key field name of the items
+// of l.
+func (w *typedWalker) keyDefault(l *mergeDiffSchema.List, name string) (interface{}, bool) {
+	atom, ok := w.schema.Resolve(l.ElementType)
+	if !ok || atom.Map == nil {
+		return nil, false
+	}
+	field, ok := atom.Map.FindField(name)
+	if !ok || field.Default == nil {
+		return nil, false
+	}
+	return field.Default, true
+}
+
+// appendPath returns a new path made of p followed by pe, leaving p intact.
+func appendPath(p fieldpath.Path, pe fieldpath.PathElement) fieldpath.Path {
+	out := make(fieldpath.Path, len(p), len(p)+1)
+	copy(out, p)
+	return append(out, pe)
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+func TestWalkTyped(t *testing.T) {
+	ctx := context.Background()
+	r := newTestCreator(t)
+	object := jsonToUnstructured(issueServiceJSON)
+	object.SetManagedFields(nil)
+
+	tv, err := r.typedObject(ctx, object)
+	if err != nil {
+		t.Fatalf("failed to convert object: %v", err)
+	}
+	var paths []string
+	err = WalkTyped(tv, func(path fieldpath.Path, _ value.Value) error {
+		paths = append(paths, FormatPath(path))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk: %v", err)
+	}
+
+	want := []string{
+		".apiVersion",
+		".kind",
+		".metadata.annotations",
+		".metadata.name",
+		".spec.clusterIP",
+		".spec.clusterIPs",
+		".spec.externalTrafficPolicy",
+		".spec.internalTrafficPolicy",
+		".spec.ipFamilies",
+		".spec.ipFamilyPolicy",
+		`.spec.ports[port=80,protocol="TCP"].name`,
+		`.spec.ports[port=80,protocol="TCP"].nodePort`,
+		`.spec.ports[port=80,protocol="TCP"].port`,
+		`.spec.ports[port=80,protocol="TCP"].protocol`,
+		`.spec.ports[port=80,protocol="TCP"].targetPort`,
+		".spec.selector.app",
+		".spec.sessionAffinity",
+		".spec.type",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("unexpected leaf paths:\n got: %v\nwant: %v", paths, want)
+	}
+}